@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by Explainer.Ask. Use errors.Is / errors.As to tell them apart.
+var (
+	ErrAuth  = errors.New("authentication failed")
+	ErrQuota = errors.New("quota exhausted")
+)
+
+// RateLimitError is returned for a 429 that is not a quota problem.
+// RetryAfter is zero when the server did not say how long to wait.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited (retry after %s): %s", e.RetryAfter, e.Message)
+	}
+	return "rate limited: " + e.Message
+}
+
+// MalformedResponseError means the API answered but not with something we can use.
+type MalformedResponseError struct {
+	Status int
+	Body   string // first bytes of the body, for the detail pane
+	Err    error
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed response (HTTP %d): %v", e.Status, e.Err)
+}
+
+func (e *MalformedResponseError) Unwrap() error { return e.Err }
+
+// APIError covers every other non-2xx status.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (HTTP %d): %s", e.Status, e.Message)
+}
+
+// temporary reports whether the request is worth retrying.
+func (e *APIError) temporary() bool {
+	return e.Status >= 500
+}
+
+// apiErrorBody is the error envelope used by OpenAI-compatible APIs.
+type apiErrorBody struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// statusError maps a non-2xx response to one of the typed errors.
+func statusError(resp *http.Response, body []byte) error {
+	var eb apiErrorBody
+	_ = json.Unmarshal(body, &eb)
+	msg := eb.Error.Message
+	if msg == "" {
+		msg = strings.TrimSpace(snippet(body))
+	}
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrAuth, msg)
+	case resp.StatusCode == http.StatusTooManyRequests &&
+		(eb.Error.Code == "insufficient_quota" || eb.Error.Type == "insufficient_quota"):
+		return fmt.Errorf("%w: %s", ErrQuota, msg)
+	case resp.StatusCode == http.StatusPaymentRequired:
+		return fmt.Errorf("%w: %s", ErrQuota, msg)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")), Message: msg}
+	}
+	return &APIError{Status: resp.StatusCode, Message: msg}
+}
+
+// parseRetryAfter understands both forms of Retry-After: seconds and an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// snippet trims a body to something that fits in the detail pane.
+func snippet(body []byte) string {
+	const max = 200
+	if len(body) > max {
+		return string(body[:max]) + "…"
+	}
+	return string(body)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// splitArgs splits a command line the way a POSIX shell would for simple
+// commands: whitespace separates words, single quotes are literal, double
+// quotes allow \" and \\, and a backslash outside quotes escapes the next
+// character. Variables, globs and pipes are not interpreted.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune // 0, '\'' or '"'
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			// inside double quotes a backslash only escapes a few characters
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", r) {
+				cur.WriteRune('\\')
+			}
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in command")
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// shellQuote quotes an argument so splitArgs (or a shell) reads it back unchanged.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(s, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// joinArgs is the inverse of splitArgs.
+func joinArgs(args []string) string {
+	q := make([]string, len(args))
+	for i, a := range args {
+		q[i] = shellQuote(a)
+	}
+	return strings.Join(q, " ")
+}
+
+// nmapValueFlags are nmap options whose value is the next argument (see
+// nmap --help; options such as -PS22 or -T4 carry it attached).
+var nmapValueFlags = map[string]bool{
+	"-p": true, "-e": true, "-g": true, "-D": true, "-S": true, "-sI": true, "-iL": true, "-iR": true,
+	"-oN": true, "-oX": true, "-oG": true, "-oS": true, "-oA": true, "-oM": true, "-b": true,
+	"--top-ports": true, "--port-ratio": true, "--exclude": true, "--excludefile": true,
+	"--exclude-ports": true, "--scanflags": true, "--ip-options": true, "--nsock-engine": true,
+	"--servicedb": true, "--versiondb": true, "--script-timeout": true,
+	"--script": true, "--script-args": true, "--script-args-file": true, "--script-help": true,
+	"--source-port": true, "--data-length": true, "--data": true, "--data-string": true,
+	"--ttl": true, "--mtu": true, "--spoof-mac": true, "--proxies": true, "--dns-servers": true,
+	"--max-retries": true, "--host-timeout": true, "--scan-delay": true, "--max-scan-delay": true,
+	"--min-rate": true, "--max-rate": true, "--min-hostgroup": true, "--max-hostgroup": true,
+	"--min-parallelism": true, "--max-parallelism": true, "--min-rtt-timeout": true,
+	"--max-rtt-timeout": true, "--initial-rtt-timeout": true, "--stats-every": true,
+	"--version-intensity": true, "--datadir": true, "--stylesheet": true, "--resume": true,
+	"--max-os-tries": true,
+}
+
+// nmapTargets returns the target specifications of an nmap command line:
+// every argument after nmap that is neither an option nor an option's value.
+func nmapTargets(args []string) []string {
+	at := -1
+	for i, a := range args {
+		if filepath.Base(a) == "nmap" {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return nil
+	}
+	var targets []string
+	for i := at + 1; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case nmapValueFlags[a]:
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			targets = append(targets, a)
+		}
+	}
+	return targets
+}
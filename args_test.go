@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNmapTargets(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{"nmap -sS 10.0.0.0/24", []string{"10.0.0.0/24"}},
+		{"nmap -p 22,80 -T4 10.0.0.1 dc01", []string{"10.0.0.1", "dc01"}},
+		{"nmap --script-timeout 30s --exclude-ports 25 10.0.0.1", []string{"10.0.0.1"}},
+		{"nmap --servicedb svc.txt --versiondb probes.txt 10.0.0.1", []string{"10.0.0.1"}},
+		{"nmap -oM out.txt --scanflags URGACKPSH 10.0.0.1", []string{"10.0.0.1"}},
+		{"nmap --ip-options R --nsock-engine epoll 10.0.0.1", []string{"10.0.0.1"}},
+		{"sudo nmap -sV --script vuln --script-args a=1 -PS22,80 10.0.0.1-5", []string{"10.0.0.1-5"}},
+		{"nmap --exclude 10.0.0.5 --top-ports=100 10.0.0.0/24", []string{"10.0.0.0/24"}},
+		{"masscan -p80 10.0.0.0/8", nil},
+	}
+	for _, tt := range tests {
+		args, err := splitArgs(tt.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nmapTargets(args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("nmapTargets(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestOutputXMLPath(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"nmap -sS -oX out.xml 10.0.0.1", "out.xml"},
+		{"nmap -sS -oA scans/dc 10.0.0.1", "scans/dc.xml"},
+		{`nmap -sS -oX "My Scans/dc01.xml" 10.0.0.1`, "My Scans/dc01.xml"},
+		{`sudo nmap -oA 'client x/full' 10.0.0.0/24`, "client x/full.xml"},
+		{"nmap -sS -oN out.nmap 10.0.0.1", ""},
+		{`nmap -oX "unterminated 10.0.0.1`, ""},
+	}
+	for _, tt := range tests {
+		if got := outputXMLPath(tt.cmd); got != tt.want {
+			t.Errorf("outputXMLPath(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestCommandTarget(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"nmap -sV 10.0.0.1", "10.0.0.1"},
+		{"nmap -sV 10.0.0.1 -oN out", "10.0.0.1"},
+		{"nmap 10.0.0.1 --script vuln", "10.0.0.1"},
+		{"sudo nmap 10.0.0.0/24 -p 22,80 --top-ports 100 -T4", "10.0.0.0/24"},
+		{"nmap -sn --exclude 10.0.0.5 10.0.0.0/24 dc01", "10.0.0.0/24"},
+		{"nmap -sV -oA scan", "fallback"},
+		{"masscan -p80 10.0.0.0/8 --rate 1000", "10.0.0.0/8"},
+	}
+	for _, tt := range tests {
+		args, err := splitArgs(tt.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := commandTarget(args, "fallback"); got != tt.want {
+			t.Errorf("commandTarget(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- scanner backends ----------
+
+// Backend turns the options selected in the builder's lists, written as
+// nmap flags, into a command line for one scanner.
+type Backend interface {
+	Name() string
+	// Command translates flags for target; dropped are the flags the
+	// scanner has no equivalent for.
+	Command(flags []string, target string) (cmd string, dropped []string)
+	// withOutput adds the options that save results under base (a path
+	// without extension) in a format parseNmapFile reads.
+	withOutput(args []string, base string) []string
+	// outputPath returns the results file a command line writes, or "".
+	outputPath(args []string) string
+	// targets returns the target specifications of a command line.
+	targets(args []string) []string
+}
+
+// backends in the order the switcher shows them.
+var backends = []Backend{nmapBackend{}, masscanBackend{}, rustscanBackend{}, naabuBackend{}}
+
+// findBackend returns the backend called name, nil if there is none.
+func findBackend(name string) Backend {
+	for _, b := range backends {
+		if b.Name() == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// commandBackend returns the backend whose program a command line runs
+// and its position, found like nmapTargets finds nmap.
+func commandBackend(args []string) (Backend, int) {
+	for i, a := range args {
+		if b := findBackend(filepath.Base(a)); b != nil {
+			return b, i
+		}
+	}
+	return nil, -1
+}
+
+// resultsPath returns the file with the results of a command line, as
+// written by -oX/-oA for nmap or by the output options of other backends.
+func resultsPath(cmd string) string {
+	if path := outputXMLPath(cmd); path != "" {
+		return path
+	}
+	args, err := splitArgs(cmd)
+	if err != nil {
+		return ""
+	}
+	if b, _ := commandBackend(args); b != nil {
+		return b.outputPath(args)
+	}
+	return ""
+}
+
+// scanTargets returns the targets of a command line for any backend, nil
+// if it runs no scanner.
+func scanTargets(args []string) []string {
+	if b, _ := commandBackend(args); b != nil {
+		return b.targets(args)
+	}
+	return nil
+}
+
+// listTargets splits the comma separated target list following name.
+func listTargets(args []string, name string) []string {
+	var targets []string
+	for _, t := range strings.Split(argAfter(args, name), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// flagValue returns the value of "-x value" or "--x value" options.
+func flagValue(flag, name string) (string, bool) {
+	if !strings.HasPrefix(flag, name+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(flag, name)), true
+}
+
+// argAfter returns the argument following name, or "".
+func argAfter(args []string, name string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == name {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func hasArg(args []string, name string) bool {
+	for _, a := range args {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ----- nmap -----
+
+type nmapBackend struct{}
+
+func (nmapBackend) Name() string { return "nmap" }
+
+func (nmapBackend) Command(flags []string, target string) (string, []string) {
+	return strings.Join(append(append([]string{"nmap"}, flags...), target), " "), nil
+}
+
+func (nmapBackend) withOutput(args []string, base string) []string {
+	_, at := commandBackend(args)
+	return append(args[:at+1:at+1], append([]string{"-oA", base}, args[at+1:]...)...)
+}
+
+func (nmapBackend) outputPath(args []string) string {
+	return outputXMLPath(joinArgs(args))
+}
+
+func (nmapBackend) targets(args []string) []string { return nmapTargets(args) }
+
+// ----- masscan -----
+
+type masscanBackend struct{}
+
+func (masscanBackend) Name() string { return "masscan" }
+
+// masscanRates stand in for nmap's timing templates, in packets/second.
+var masscanRates = map[string]string{"-T3": "1000", "-T4": "10000", "-T5": "100000"}
+
+func (masscanBackend) Command(flags []string, target string) (string, []string) {
+	parts := []string{"masscan"}
+	var dropped []string
+	ports, top, udp, tcp := "", "", false, false
+	for _, f := range flags {
+		switch {
+		case f == "-Pn":
+			// masscan never pings
+		case f == "-sS":
+			tcp = true // masscan always sends SYNs
+		case f == "-sU":
+			udp = true
+		case f == "-sV":
+			tcp = true
+			parts = append(parts, "--banners")
+		case f == "-p-":
+			ports = "1-65535"
+		case f == "-F":
+			top = "100"
+		case masscanRates[f] != "":
+			parts = append(parts, "--rate", masscanRates[f])
+		default:
+			if v, ok := flagValue(f, "-p"); ok {
+				ports = v
+			} else if v, ok := flagValue(f, "--top-ports"); ok {
+				top = v
+			} else if v, ok := flagValue(f, "-S"); ok {
+				parts = append(parts, "--source-ip", v)
+			} else {
+				dropped = append(dropped, f)
+			}
+		}
+	}
+	udpPorts := "U:" + strings.ReplaceAll(ports, ",", ",U:")
+	switch {
+	case ports != "" && udp && tcp:
+		parts = append(parts, "-p", ports+","+udpPorts)
+	case ports != "" && udp:
+		parts = append(parts, "-p", udpPorts)
+	case ports != "":
+		parts = append(parts, "-p", ports)
+	default:
+		if top == "" {
+			top = "1000" // nmap's default; masscan needs ports
+		}
+		if udp {
+			dropped = append(dropped, "-sU") // --top-ports is TCP only
+		}
+		parts = append(parts, "--top-ports", top)
+	}
+	return strings.Join(append(parts, target), " "), dropped
+}
+
+func (masscanBackend) withOutput(args []string, base string) []string {
+	return append(append([]string(nil), args...), "-oJ", base+".json")
+}
+
+func (masscanBackend) outputPath(args []string) string {
+	return argAfter(args, "-oJ")
+}
+
+// masscanValueFlags are the masscan options that take a separate value.
+var masscanValueFlags = map[string]bool{
+	"-p": true, "--ports": true, "--range": true, "--rate": true, "--max-rate": true,
+	"--top-ports": true, "--source-ip": true, "--source-port": true, "--exclude": true,
+	"--excludefile": true, "-iL": true, "--includefile": true, "-e": true, "--adapter": true,
+	"--router-mac": true, "--wait": true, "--retries": true, "--ttl": true, "-c": true,
+	"--conf": true, "-oJ": true, "-oX": true, "-oG": true, "-oL": true, "-oB": true,
+}
+
+func (masscanBackend) targets(args []string) []string {
+	_, at := commandBackend(args)
+	var targets []string
+	for i := at + 1; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--range" && i+1 < len(args):
+			targets = append(targets, args[i+1])
+			i++
+		case masscanValueFlags[a]:
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			targets = append(targets, a)
+		}
+	}
+	return targets
+}
+
+// ----- rustscan -----
+
+// rustscanBackend finds open ports with rustscan and hands them to nmap,
+// so every option but the port selection still applies: it is passed to
+// nmap after "--".
+type rustscanBackend struct{}
+
+func (rustscanBackend) Name() string { return "rustscan" }
+
+var rustscanTiming = map[string][]string{
+	"-T3": {"-b", "1000"},
+	"-T4": nil, // rustscan's defaults
+	"-T5": {"-b", "10000", "-t", "1000"},
+}
+
+func (rustscanBackend) Command(flags []string, target string) (string, []string) {
+	parts := []string{"rustscan", "-a", strings.Join(strings.Fields(target), ",")}
+	var nmapOpts []string
+	for _, f := range flags {
+		switch {
+		case f == "-p-":
+			parts = append(parts, "-r", "1-65535")
+		case f == "-F", strings.HasPrefix(f, "--top-ports "):
+			parts = append(parts, "--top") // rustscan only knows its top 1000
+		default:
+			if v, ok := flagValue(f, "-p"); ok {
+				if strings.Contains(v, "-") && !strings.Contains(v, ",") {
+					parts = append(parts, "-r", v)
+				} else {
+					parts = append(parts, "-p", v)
+				}
+				continue
+			}
+			if t, ok := rustscanTiming[f]; ok {
+				parts = append(parts, t...)
+			} else if f == "-sU" {
+				parts = append(parts, "--udp")
+			}
+			nmapOpts = append(nmapOpts, f)
+		}
+	}
+	parts = append(parts, "--")
+	return strings.Join(append(parts, nmapOpts...), " "), nil
+}
+
+func (rustscanBackend) withOutput(args []string, base string) []string {
+	out := append([]string(nil), args...)
+	if !hasArg(out, "--") {
+		out = append(out, "--")
+	}
+	return append(out, "-oA", base)
+}
+
+func (rustscanBackend) outputPath(args []string) string {
+	return outputXMLPath(joinArgs(args))
+}
+
+func (rustscanBackend) targets(args []string) []string { return listTargets(args, "-a") }
+
+// ----- naabu -----
+
+type naabuBackend struct{}
+
+func (naabuBackend) Name() string { return "naabu" }
+
+var naabuFlags = map[string][]string{
+	"-Pn": {"-Pn"},
+	"-PE": {"-pe"},
+	"-PP": {"-pp"},
+	"-sS": {"-scan-type", "s"},
+	"-sT": {"-scan-type", "c"},
+	"-F":  {"-top-ports", "100"},
+	"-p-": {"-p", "-"},
+	"-T3": {"-rate", "500"},
+	"-T4": nil, // naabu's default rate
+	"-T5": {"-rate", "5000"},
+}
+
+func (naabuBackend) Command(flags []string, target string) (string, []string) {
+	parts := []string{"naabu", "-host", strings.Join(strings.Fields(target), ",")}
+	var dropped []string
+	udp := false
+	for _, f := range flags {
+		if f == "-sU" {
+			udp = true
+		}
+	}
+	for _, f := range flags {
+		if opts, ok := naabuFlags[f]; ok {
+			parts = append(parts, opts...)
+			continue
+		}
+		switch {
+		case f == "-sU":
+		case strings.HasPrefix(f, "-PS"):
+			parts = append(parts, "-ps", strings.TrimPrefix(f, "-PS"))
+		default:
+			if v, ok := flagValue(f, "-p"); ok {
+				if udp {
+					v = "u:" + strings.ReplaceAll(v, ",", ",u:")
+				}
+				parts = append(parts, "-p", v)
+			} else if v, ok := flagValue(f, "--top-ports"); ok && (v == "100" || v == "1000") {
+				parts = append(parts, "-top-ports", v)
+			} else if v, ok := flagValue(f, "-S"); ok {
+				parts = append(parts, "-source-ip", v)
+			} else {
+				dropped = append(dropped, f)
+			}
+		}
+	}
+	if udp && !strings.Contains(strings.Join(parts, " "), "u:") {
+		dropped = append(dropped, "-sU") // naabu scans UDP only with u: ports
+	}
+	return strings.Join(parts, " "), dropped
+}
+
+func (naabuBackend) withOutput(args []string, base string) []string {
+	out := append([]string(nil), args...)
+	if !hasArg(out, "-json") {
+		out = append(out, "-json")
+	}
+	return append(out, "-o", base+".json")
+}
+
+func (naabuBackend) outputPath(args []string) string {
+	if !hasArg(args, "-json") {
+		return ""
+	}
+	return argAfter(args, "-o")
+}
+
+func (naabuBackend) targets(args []string) []string { return listTargets(args, "-host") }
+
+// checkScanner refuses a command line whose scanner is not installed.
+// rustscan hands its ports to nmap, so it needs both.
+func checkScanner(info NmapInfo, args []string) error {
+	b, _ := commandBackend(args)
+	if b == nil || b.Name() == "nmap" {
+		return info.Check(args)
+	}
+	if _, err := exec.LookPath(b.Name()); err != nil {
+		return fmt.Errorf("%s not found on $PATH", b.Name())
+	}
+	if b.Name() == "rustscan" && !info.Found() {
+		return info.Err
+	}
+	return nil
+}
+
+// runsNmap reports whether a command line runs nmap itself, the only
+// scanner --privileged applies to.
+func runsNmap(args []string) bool {
+	b, _ := commandBackend(args)
+	return b != nil && b.Name() == "nmap"
+}
+
+// ----- outputs of other scanners -----
+
+// 10.0.0.5 -> [22,80,443]
+var rustscanLineRe = regexp.MustCompile(`^(\S+) -> \[([\d,\s]*)\]$`)
+
+// masscanRecord is one entry of masscan -oJ: a host and, usually, one port.
+type masscanRecord struct {
+	IP        string `json:"ip"`
+	Timestamp string `json:"timestamp"`
+	Ports     []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Reason  string `json:"reason"`
+		Service struct {
+			Name   string `json:"name"`
+			Banner string `json:"banner"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// parseMasscanJSON reads masscan -oJ output. Older masscan versions leave
+// a trailing comma before the closing bracket, so when the whole file is
+// not valid JSON every record is read from its own line.
+func parseMasscanJSON(data []byte) (*NmapRun, error) {
+	var records []masscanRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		records = nil
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+			if !strings.HasPrefix(line, "{") {
+				continue
+			}
+			var r masscanRecord
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				return nil, err
+			}
+			records = append(records, r)
+		}
+	}
+	run := &NmapRun{Args: "masscan"}
+	for _, r := range records {
+		if r.IP == "" {
+			continue
+		}
+		if t, err := strconv.ParseInt(r.Timestamp, 10, 64); err == nil && (run.Start == 0 || t < run.Start) {
+			run.Start = t
+		}
+		h := newImportedHost(r.IP, "")
+		h.Status.State = "up"
+		for _, p := range r.Ports {
+			port := Port{Protocol: p.Proto, PortID: p.Port, State: PortState{State: p.Status, Reason: p.Reason}}
+			if port.State.State == "" {
+				port.State.State = "open" // banner records carry no status
+			}
+			port.Service.Name = p.Service.Name
+			if p.Service.Banner != "" {
+				port.Scripts = []Script{{ID: "banner", Output: p.Service.Banner}}
+			}
+			h.Ports = append(h.Ports, port)
+		}
+		run.Hosts = append(run.Hosts, h)
+	}
+	return run, nil
+}
+
+// parseNaabuJSON reads naabu -json output, one open port per line. Older
+// naabu versions write the port as an object.
+func parseNaabuJSON(data []byte) (*NmapRun, error) {
+	run := &NmapRun{Args: "naabu"}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var r struct {
+			Host      string          `json:"host"`
+			IP        string          `json:"ip"`
+			Port      json.RawMessage `json:"port"`
+			Protocol  string          `json:"protocol"`
+			Timestamp time.Time       `json:"timestamp"`
+		}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return nil, err
+		}
+		var port int
+		if err := json.Unmarshal(r.Port, &port); err != nil {
+			var obj struct {
+				Port int `json:"Port"`
+			}
+			if err := json.Unmarshal(r.Port, &obj); err != nil {
+				return nil, fmt.Errorf("port %s: %w", r.Port, err)
+			}
+			port = obj.Port
+		}
+		addr, name := r.IP, r.Host
+		if addr == "" {
+			addr, name = r.Host, ""
+		}
+		if name == addr {
+			name = ""
+		}
+		if t := r.Timestamp.Unix(); !r.Timestamp.IsZero() && (run.Start == 0 || t < run.Start) {
+			run.Start = t
+		}
+		proto := strings.ToLower(r.Protocol)
+		if proto == "" {
+			proto = "tcp"
+		}
+		h := newImportedHost(addr, name)
+		h.Status.State = "up"
+		h.Ports = []Port{{Protocol: proto, PortID: port, State: PortState{State: "open"}}}
+		run.Hosts = append(run.Hosts, h)
+	}
+	return run, nil
+}
+
+// parseRustscanGreppable reads rustscan -g output: "ip -> [ports]".
+func parseRustscanGreppable(data []byte) (*NmapRun, error) {
+	run := &NmapRun{Args: "rustscan"}
+	for _, line := range strings.Split(string(data), "\n") {
+		m := rustscanLineRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		h := newImportedHost(m[1], "")
+		h.Status.State = "up"
+		for _, f := range strings.Split(m[2], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+				h.Ports = append(h.Ports, Port{Protocol: "tcp", PortID: n, State: PortState{State: "open"}})
+			}
+		}
+		run.Hosts = append(run.Hosts, h)
+	}
+	return run, nil
+}
+
+// detectBackendFormat recognises the outputs of masscan, naabu and
+// rustscan, "" if data is none of them.
+func detectBackendFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	first := trimmed
+	if i := bytes.IndexByte(first, '\n'); i >= 0 {
+		first = bytes.TrimSpace(first[:i])
+	}
+	switch {
+	case len(trimmed) == 0:
+	case bytes.Contains(trimmed[:minInt(len(trimmed), 4096)], []byte(`"ports"`)) && (trimmed[0] == '[' || trimmed[0] == '{'):
+		return formatMasscan
+	case trimmed[0] == '{' && bytes.Contains(first, []byte(`"port"`)):
+		return formatNaabu
+	case rustscanLineRe.Match(first):
+		return formatRustscan
+	}
+	return ""
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
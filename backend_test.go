@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// masscan 1.3 -oJ: records separated by lines holding only a comma
+const masscanJSON = `[
+{   "ip": "10.0.4.12",   "timestamp": "1714831629", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }
+,
+{   "ip": "10.0.4.12",   "timestamp": "1714831628", "ports": [ {"port": 22, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }
+,
+{   "ip": "10.0.4.20",   "timestamp": "1714831630", "ports": [ {"port": 161, "proto": "udp", "status": "open", "reason": "none", "ttl": 128} ] }
+,
+{   "ip": "10.0.4.12",   "timestamp": "1714831633", "ports": [ {"port": 22, "proto": "tcp", "service": {"name": "ssh", "banner": "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"} } ] }
+]
+`
+
+// masscan 1.0 -oJ: a comma after every record, also the last one
+const masscanTrailingComma = `[
+{   "ip": "10.0.4.12",   "timestamp": "1714831628", "ports": [ {"port": 22, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{   "ip": "10.0.4.20",   "timestamp": "1714831630", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 128} ] },
+]
+`
+
+// naabu -json, one line per open port; the last line is from naabu 2.0,
+// which wrote the port as an object
+const naabuJSON = `{"host":"scanme.nmap.org","ip":"45.33.32.156","timestamp":"2024-05-04T14:07:09.812455Z","port":22,"protocol":"tcp","tls":false}
+{"host":"scanme.nmap.org","ip":"45.33.32.156","timestamp":"2024-05-04T14:07:08.102933Z","port":80,"protocol":"tcp","tls":false}
+{"host":"10.0.4.12","ip":"10.0.4.12","timestamp":"2024-05-04T14:07:10.5Z","port":53,"protocol":"udp"}
+{"host":"10.0.4.20","ip":"10.0.4.20","port":{"Port":8080,"Protocol":0,"TLS":false}}
+`
+
+// rustscan -g
+const rustscanGreppable = `10.0.4.12 -> [22,80,443]
+10.0.4.20 -> [3389]
+`
+
+// portLines flattens a run into "addr [name] port/proto state reason" lines.
+func portLines(run *NmapRun) []string {
+	var lines []string
+	for _, h := range run.Hosts {
+		name := ""
+		if len(h.Hostnames) > 0 {
+			name = " " + h.Hostnames[0].Name
+		}
+		for _, p := range h.Ports {
+			line := fmt.Sprintf("%s%s %d/%s %s %s", h.Addr(), name, p.PortID, p.Protocol, p.State.State, p.State.Reason)
+			if p.Service.Name != "" {
+				line += " " + p.Service.Name
+			}
+			for _, s := range p.Scripts {
+				line += " " + s.ID + "=" + s.Output
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestParseBackendOutputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) (*NmapRun, error)
+		data  string
+		start int64
+		want  []string
+	}{
+		{"masscan", parseMasscanJSON, masscanJSON, 1714831628, []string{
+			"10.0.4.12 443/tcp open syn-ack",
+			"10.0.4.12 22/tcp open syn-ack",
+			"10.0.4.20 161/udp open none",
+			"10.0.4.12 22/tcp open  ssh banner=SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6",
+		}},
+		{"masscan trailing comma", parseMasscanJSON, masscanTrailingComma, 1714831628, []string{
+			"10.0.4.12 22/tcp open syn-ack",
+			"10.0.4.20 80/tcp open syn-ack",
+		}},
+		{"masscan empty", parseMasscanJSON, "[\n]\n", 0, nil},
+		{"naabu", parseNaabuJSON, naabuJSON, 1714831628, []string{
+			"45.33.32.156 scanme.nmap.org 22/tcp open ",
+			"45.33.32.156 scanme.nmap.org 80/tcp open ",
+			"10.0.4.12 53/udp open ",
+			"10.0.4.20 8080/tcp open ",
+		}},
+		{"rustscan", parseRustscanGreppable, rustscanGreppable, 0, []string{
+			"10.0.4.12 22/tcp open ",
+			"10.0.4.12 80/tcp open ",
+			"10.0.4.12 443/tcp open ",
+			"10.0.4.20 3389/tcp open ",
+		}},
+	}
+	for _, tt := range tests {
+		run, err := tt.parse([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := portLines(run); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+		if run.Start != tt.start {
+			t.Errorf("%s: start %d, want %d", tt.name, run.Start, tt.start)
+		}
+		for _, h := range run.Hosts {
+			if h.Status.State != "up" {
+				t.Errorf("%s: host %s is %q, want up", tt.name, h.Addr(), h.Status.State)
+			}
+		}
+	}
+}
+
+func TestParseBackendOutputErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) (*NmapRun, error)
+		data  string
+	}{
+		{"masscan truncated record", parseMasscanJSON, "[\n{   \"ip\": \"10.0.4.12\", \"ports\": [ {\"port\": 22\n]\n"},
+		{"naabu not JSON", parseNaabuJSON, "scanme.nmap.org:22\n"},
+		{"naabu bad port", parseNaabuJSON, `{"ip":"10.0.4.12","port":"ssh"}` + "\n"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.parse([]byte(tt.data)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestDetectBackendFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"masscan", masscanJSON, formatMasscan},
+		{"masscan trailing comma", masscanTrailingComma, formatMasscan},
+		{"naabu", naabuJSON, formatNaabu},
+		{"rustscan", rustscanGreppable, formatRustscan},
+		{"rustscan no ports", "10.0.4.12 -> []\n", formatRustscan},
+		{"empty", "  \n", ""},
+		{"naabu plain", "scanme.nmap.org:22\n", ""},
+		{"other JSON", `{"name":"acme-2025"}`, ""},
+	}
+	for _, tt := range tests {
+		if got := detectBackendFormat([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackendCommand(t *testing.T) {
+	tests := []struct {
+		backend Backend
+		flags   []string
+		target  string
+		want    string
+		dropped []string
+	}{
+		{nmapBackend{}, []string{"-sS", "-p 22,80"}, "10.0.4.0/24", "nmap -sS -p 22,80 10.0.4.0/24", nil},
+
+		{masscanBackend{}, []string{"-sS", "-p 22,80"}, "10.0.4.0/24", "masscan -p 22,80 10.0.4.0/24", nil},
+		{masscanBackend{}, []string{"-p-", "-T4"}, "10.0.4.0/24", "masscan --rate 10000 -p 1-65535 10.0.4.0/24", nil},
+		{masscanBackend{}, []string{"-sU", "-p 53,161"}, "10.0.4.0/24", "masscan -p U:53,U:161 10.0.4.0/24", nil},
+		{masscanBackend{}, []string{"-sS", "-sU", "-p 53"}, "10.0.4.0/24", "masscan -p 53,U:53 10.0.4.0/24", nil},
+		{masscanBackend{}, []string{"--top-ports 100"}, "10.0.4.0/24", "masscan --top-ports 100 10.0.4.0/24", nil},
+		{masscanBackend{}, []string{"-F"}, "10.0.4.0/24", "masscan --top-ports 100 10.0.4.0/24", nil},
+		{masscanBackend{}, nil, "10.0.4.0/24", "masscan --top-ports 1000 10.0.4.0/24", nil},
+		{masscanBackend{}, []string{"-sU", "--top-ports 50"}, "10.0.4.0/24", "masscan --top-ports 50 10.0.4.0/24", []string{"-sU"}},
+		{masscanBackend{}, []string{"-Pn", "-sV", "-O", "-S 10.0.4.2", "--script vuln", "-p 80"}, "10.0.4.0/24",
+			"masscan --banners --source-ip 10.0.4.2 -p 80 10.0.4.0/24", []string{"-O", "--script vuln"}},
+
+		{naabuBackend{}, []string{"-sS", "-p 22,80"}, "10.0.4.12 10.0.4.20", "naabu -host 10.0.4.12,10.0.4.20 -scan-type s -p 22,80", nil},
+		{naabuBackend{}, []string{"-p 53,161", "-sU"}, "10.0.4.12", "naabu -host 10.0.4.12 -p u:53,u:161", nil},
+		{naabuBackend{}, []string{"--top-ports 1000"}, "10.0.4.12", "naabu -host 10.0.4.12 -top-ports 1000", nil},
+		{naabuBackend{}, []string{"--top-ports 50"}, "10.0.4.12", "naabu -host 10.0.4.12", []string{"--top-ports 50"}},
+		{naabuBackend{}, []string{"-sU", "--top-ports 100"}, "10.0.4.12", "naabu -host 10.0.4.12 -top-ports 100", []string{"-sU"}},
+		{naabuBackend{}, []string{"-Pn", "-PS22,443", "-T5", "-sV", "-O"}, "10.0.4.12", "naabu -host 10.0.4.12 -Pn -ps 22,443 -rate 5000", []string{"-sV", "-O"}},
+
+		{rustscanBackend{}, []string{"-sV", "-p 22,80"}, "10.0.4.12", "rustscan -a 10.0.4.12 -p 22,80 -- -sV", nil},
+		{rustscanBackend{}, []string{"-p 1-1024", "-T5"}, "10.0.4.12 10.0.4.20", "rustscan -a 10.0.4.12,10.0.4.20 -r 1-1024 -b 10000 -t 1000 -- -T5", nil},
+		{rustscanBackend{}, []string{"-p-"}, "10.0.4.12", "rustscan -a 10.0.4.12 -r 1-65535 --", nil},
+		{rustscanBackend{}, []string{"--top-ports 100", "-sU", "-sC"}, "10.0.4.12", "rustscan -a 10.0.4.12 --top --udp -- -sU -sC", nil},
+	}
+	for _, tt := range tests {
+		got, dropped := tt.backend.Command(tt.flags, tt.target)
+		if got != tt.want || !reflect.DeepEqual(dropped, tt.dropped) {
+			t.Errorf("%s %q: got %q (dropped %q), want %q (dropped %q)",
+				tt.backend.Name(), tt.flags, got, dropped, tt.want, tt.dropped)
+		}
+	}
+}
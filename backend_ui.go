@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/rivo/tview"
+)
+
+// backendNotes describe each backend in the switcher.
+var backendNotes = map[string]string{
+	"nmap":     "Every option as selected",
+	"masscan":  "Fast port discovery on large ranges; needs root, writes -oJ",
+	"rustscan": "Finds open ports, then runs nmap with the other options",
+	"naabu":    "Fast port discovery; writes JSON lines",
+}
+
+// backendForm lets the user pick the scanner the builder translates the
+// selected options to.
+func backendForm(current Backend, done func(b Backend, ok bool)) tview.Primitive {
+	list := tview.NewList()
+	at := 0
+	for i, b := range backends {
+		b := b
+		label := b.Name()
+		if b.Name() == current.Name() {
+			label, at = "✓ "+label, i
+		}
+		list.AddItem(label, backendNotes[b.Name()], 0, func() { done(b, true) })
+	}
+	list.SetCurrentItem(at)
+	list.SetDoneFunc(func() { done(current, false) })
+	list.SetBorder(true).SetTitle("Backend")
+	paintWidget(list, themePlain)
+	return modal(list, 70, 2*len(backends)+2)
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// subcommands run without the TUI: nmapx <name> [args...]
+var subcommands map[string]func(args []string) error
+
+func init() {
+	subcommands = map[string]func(args []string) error{
+		"workspace": workspaceCmd,
+		"query":     queryCmd,
+		"import":    importCmd,
+		"report":    reportCmd,
+		"pipeline":  pipelineCmd,
+		"merge":     mergeCmd,
+	}
+}
+
+// runSubcommand runs os.Args[1] if it names a subcommand and reports whether it did.
+func runSubcommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	cmd, ok := subcommands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "nmapx:", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+const workspaceUsage = `usage:
+  nmapx workspace list
+  nmapx workspace export <name> <file.tar.gz>
+  nmapx workspace import <file.tar.gz> [name]`
+
+func workspaceCmd(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(workspaceUsage)
+	}
+	switch args[0] {
+	case "list":
+		names, err := listWorkspaces()
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(names, "\n"))
+		return nil
+	case "export":
+		if len(args) != 3 {
+			return fmt.Errorf(workspaceUsage)
+		}
+		ws, err := openWorkspace(args[1])
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(args[2])
+		if err != nil {
+			return err
+		}
+		if err := exportWorkspace(ws, f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	case "import":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf(workspaceUsage)
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		name := ""
+		if len(args) == 3 {
+			name = args[2]
+		}
+		ws, err := importWorkspace(f, name)
+		if err != nil {
+			return err
+		}
+		fmt.Println("imported workspace", ws.Name)
+		return nil
+	}
+	return fmt.Errorf(workspaceUsage)
+}
+
+// parseDBFlags parses subcommand flags with --workspace and returns the
+// results database to use. help is true if -h was given.
+func parseDBFlags(fs *flag.FlagSet, args []string) (db *ResultsDB, help bool, err error) {
+	wsName := fs.String("workspace", "", "workspace to use instead of the global database")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil, true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	var ws *Workspace
+	if *wsName != "" {
+		if ws, err = openWorkspace(*wsName); err != nil {
+			return nil, false, err
+		}
+	}
+	return newResultsDB(ws), false, nil
+}
+
+// queryCmd prints stored results: nmapx query [--workspace name] <terms...>
+func queryCmd(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmapx query [--workspace name] <terms...>\n"+queryHelp)
+	}
+	db, help, err := parseDBFlags(fs, args)
+	if help || err != nil {
+		return err
+	}
+	q, err := parseQuery(strings.Join(fs.Args(), " "), time.Now())
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(q)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tHOST\tHOSTNAME\tPORT\tSTATE\tSERVICE\tVERSION")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%s\t%s\t%s\t%s\n",
+			r.Time.Local().Format("2006-01-02 15:04"), r.Addr, r.Hostname,
+			r.Port.Port, r.Port.Proto, r.Port.State, r.Port.Service,
+			strings.TrimSpace(r.Port.Product+" "+r.Port.Version))
+	}
+	return tw.Flush()
+}
+
+// importCmd stores existing nmap output: nmapx import [--workspace name] <files...>
+func importCmd(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmapx import [--workspace name] <file.xml|.gnmap|.nmap|.json>...")
+	}
+	db, help, err := parseDBFlags(fs, args)
+	if help || err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no files given")
+	}
+	results, err := importFiles(db, fs.Args())
+	for _, r := range results {
+		fmt.Printf("%s: %d hosts (%s", r.Source, r.Hosts, r.Format)
+		if len(r.Files) > 1 {
+			fmt.Printf(", merged from %d files", len(r.Files))
+		}
+		fmt.Println(")")
+	}
+	return err
+}
+
+// reportCmd renders a report of stored results, or of the given files:
+// nmapx report [--workspace name] [-f md|html|csv|json] [-o file] [-q terms] [files...]
+func reportCmd(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("f", "", "format: md, html, csv or json (default from -o, else md)")
+	out := fs.String("o", "", "output file (default stdout)")
+	title := fs.String("title", "Nmap scan report", "report title")
+	terms := fs.String("q", "latest", "query selecting stored results")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmapx report [--workspace name] [-f format] [-o file] [-q terms] [files...]")
+		fs.PrintDefaults()
+	}
+	db, help, err := parseDBFlags(fs, args)
+	if help || err != nil {
+		return err
+	}
+	q, err := parseQuery(*terms, time.Now())
+	if err != nil {
+		return err
+	}
+	var hosts []HostRecord
+	if fs.NArg() > 0 {
+		runs, results, err := parseNmapFiles(fs.Args())
+		if err != nil {
+			return err
+		}
+		sources := make([]string, len(results))
+		for i, r := range results {
+			sources[i] = r.Source
+		}
+		hosts = hostsFromRuns(runs, sources)
+	} else if hosts, err = db.Hosts(q); err != nil {
+		return err
+	}
+	r := newReport(*title, hosts, q)
+	if *out != "" {
+		return saveReport(*out, *format, r)
+	}
+	f, err := reportFormat(*format, "")
+	if err != nil {
+		return err
+	}
+	return writeReport(os.Stdout, f, r)
+}
+
+// mergeCmd joins scan results into one nmap XML document:
+// nmapx merge [-o out.xml] <files...>
+func mergeCmd(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: nmapx merge <file.xml>... [-o out.xml]")
+		fs.PrintDefaults()
+	}
+	// -o may come after the files
+	var files []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no files given")
+	}
+	merged, err := mergeNmapFiles(files, "nmapx merge "+strings.Join(files, " "))
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return encodeNmapXML(os.Stdout, merged)
+	}
+	if err := writeNmapXML(*out, merged); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d hosts from %d files\n", *out, len(merged.Hosts), len(files))
+	return nil
+}
+
+const pipelineUsage = `usage:
+  nmapx pipeline list
+  nmapx pipeline run [--workspace name] [--confirm-risky categories] <pipeline> <targets...>`
+
+// categoryList reads a comma-separated list of NSE categories.
+func categoryList(s string) []string {
+	var cats []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			cats = append(cats, c)
+		}
+	}
+	return cats
+}
+
+// checkPipelineRisk refuses a pipeline whose steps run risky NSE categories
+// that are not in ack.
+func checkPipelineRisk(p Pipeline, scripts []NSEScript, ack []string) error {
+	missing := unconfirmed(riskyCommands(p.Commands(), scripts), ack)
+	if len(missing) == 0 {
+		return nil
+	}
+	list := strings.Join(missing, ",")
+	return fmt.Errorf("pipeline %q runs NSE scripts in %s, which can crash services, lock accounts or change data: add --confirm-risky %s to run it", p.Name, list, list)
+}
+
+// pipelineCmd lists the configured pipelines or runs one in the terminal.
+func pipelineCmd(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(pipelineUsage)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	pipelines, errs := validPipelines(cfg.Pipelines)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "config:", err)
+	}
+	switch args[0] {
+	case "list":
+		for _, p := range pipelines {
+			fmt.Printf("%s\n%s\n", p.Name, p.Describe())
+		}
+		return nil
+	case "run":
+	default:
+		return fmt.Errorf(pipelineUsage)
+	}
+
+	fs := flag.NewFlagSet("pipeline run", flag.ContinueOnError)
+	wsName := fs.String("workspace", "", "workspace to scan in")
+	confirm := fs.String("confirm-risky", "", "risky NSE categories the pipeline may run, e.g. vuln,brute")
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), pipelineUsage) }
+	if err := fs.Parse(args[1:]); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf(pipelineUsage)
+	}
+	p, ok := findPipeline(pipelines, fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("no pipeline named %q (see nmapx pipeline list)", fs.Arg(0))
+	}
+	target := strings.Join(fs.Args()[1:], " ")
+	var ws *Workspace
+	if *wsName != "" {
+		if ws, err = openWorkspace(*wsName); err != nil {
+			return err
+		}
+	}
+	outputs := newOutputManager(workspaceOutput(cfg.Output, ws))
+	db := newResultsDB(ws)
+	nmapInfo := probeNmap(cfg.Nmap)
+	if nmapInfo.Err != nil {
+		return nmapInfo.Err
+	}
+	priv := detectPrivileges(nmapInfo.Path)
+	scripts, _ := loadNSECatalog(cfg.NSE, nmapInfo.Path)
+	// no form to type them in: risky categories are confirmed on the command line
+	ack := categoryList(*confirm)
+	if err := checkPipelineRisk(p, scripts, ack); err != nil {
+		return err
+	}
+
+	mgr := newJobManager(cfg.Jobs)
+	// store before the next step starts, as the TUI does
+	mgr.OnFinish = func(j *Job) {
+		path := resultsPath(j.Cmd)
+		if st, _ := j.State(); st != JobDone || path == "" {
+			return
+		}
+		if _, err := db.storeFile(path); err != nil {
+			fmt.Fprintln(os.Stderr, "nmapx:", err)
+		}
+	}
+	launch := func(name, cmdline string, then JobOption) error {
+		if missing := unconfirmed(riskyCommands([]string{cmdline}, scripts), ack); len(missing) > 0 {
+			return fmt.Errorf("%s runs NSE scripts in %s, not confirmed with --confirm-risky", name, strings.Join(missing, ","))
+		}
+		// later steps read this step's XML, whatever output.auto_oa says
+		cmdline, err := prepareScan(ws, outputs, scripts, name, cmdline, target, true, true)
+		if err != nil {
+			return err
+		}
+		cmdline = nmapInfo.Command(cmdline)
+		args, err := splitArgs(cmdline)
+		if err != nil {
+			return err
+		}
+		var j *Job
+		switch {
+		case !needsRoot(args) || priv.Root:
+			j, err = mgr.Add(name, cmdline, then)
+		case priv.NmapCaps && runsNmap(args):
+			j, err = mgr.Add(name, joinArgs(withPrivileged(args)), then)
+		case sudoCached():
+			j, err = mgr.AddSudo(name, cmdline, "", then)
+		default:
+			return fmt.Errorf("%s needs root: run nmapx as root or refresh sudo (sudo -v) first", name)
+		}
+		if err == nil {
+			fmt.Printf("job #%d %s: %s\n", j.ID, name, j.Cmd)
+		}
+		return err
+	}
+	run, err := newPipelineRun(1, p, target, launch)
+	if err != nil {
+		return err
+	}
+	changed := make(chan struct{}, 1)
+	run.OnChange = func(*PipelineRun) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	run.Start()
+	last := ""
+	for {
+		select {
+		case <-changed:
+		case <-interrupt:
+			mgr.StopAll()
+			return fmt.Errorf("interrupted")
+		}
+		if status := strings.Join(run.Status(), "\n"); status != last {
+			fmt.Println(status)
+			last = status
+		}
+		if run.Finished() {
+			break
+		}
+	}
+	for _, s := range run.Steps() {
+		if s.State == StepFailed {
+			return fmt.Errorf("pipeline %q did not complete", p.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// clipboardBackend is one way of putting text on the clipboard.
+type clipboardBackend struct {
+	name      string
+	available func() bool
+	copy      func(text string) error
+}
+
+// lookPath y getenv se pueden sustituir en tests
+var (
+	lookPath = exec.LookPath
+	getenv   = os.Getenv
+)
+
+// osc52 writes the OSC 52 sequence to the terminal. It is set once the
+// tcell screen exists (see setOSC52Screen); nil means no terminal to write to.
+var osc52 func(text string) error
+
+// clipboardBackends returns the chain tried by copyToClipboard, in order.
+func clipboardBackends() []clipboardBackend {
+	return []clipboardBackend{
+		toolBackend("pbcopy", func() bool { return runtime.GOOS == "darwin" }),
+		toolBackend("wl-copy", func() bool { return getenv("WAYLAND_DISPLAY") != "" }),
+		toolBackend("xclip", func() bool { return getenv("DISPLAY") != "" }, "-selection", "clipboard"),
+		toolBackend("xsel", func() bool { return getenv("DISPLAY") != "" }, "--clipboard", "--input"),
+		{
+			name:      "tmux",
+			available: func() bool { return getenv("TMUX") != "" && hasTool("tmux") },
+			copy: func(text string) error {
+				// -w also sets the outer terminal clipboard (tmux >= 3.2)
+				if err := pipeTo(text, "tmux", "load-buffer", "-w", "-"); err == nil {
+					return nil
+				}
+				return pipeTo(text, "tmux", "load-buffer", "-")
+			},
+		},
+		{
+			name:      "osc52",
+			available: func() bool { return osc52 != nil },
+			copy:      func(text string) error { return osc52(text) },
+		},
+	}
+}
+
+// toolBackend builds a backend for a command that reads the text on stdin.
+func toolBackend(tool string, env func() bool, arg ...string) clipboardBackend {
+	return clipboardBackend{
+		name:      tool,
+		available: func() bool { return env() && hasTool(tool) },
+		copy:      func(text string) error { return pipeTo(text, tool, arg...) },
+	}
+}
+
+func hasTool(name string) bool {
+	_, err := lookPath(name)
+	return err == nil
+}
+
+func pipeTo(text, name string, arg ...string) error {
+	c := execCommand(name, arg...)
+	c.Stdin = strings.NewReader(text)
+	return c.Run()
+}
+
+// copyToClipboard copia el texto al portapapeles usando el primer backend
+// disponible que funcione.
+func copyToClipboard(text string) error {
+	var tried []string
+	for _, b := range clipboardBackends() {
+		if !b.available() {
+			continue
+		}
+		err := b.copy(text)
+		if err == nil {
+			return nil
+		}
+		tried = append(tried, fmt.Sprintf("%s: %v", b.name, err))
+	}
+	if len(tried) == 0 {
+		return fmt.Errorf("No clipboard backend available (pbcopy, wl-copy, xclip, xsel, tmux, OSC 52)")
+	}
+	return fmt.Errorf("clipboard failed: %s", strings.Join(tried, "; "))
+}
+
+// setOSC52Screen enables the OSC 52 backend on the screen's terminal.
+func setOSC52Screen(screen tcell.Screen) {
+	tty, ok := screen.Tty()
+	if !ok {
+		return
+	}
+	osc52 = func(text string) error {
+		_, err := tty.Write([]byte(osc52Sequence(text, getenv("TMUX") != "")))
+		return err
+	}
+}
+
+// osc52Sequence builds the escape sequence that asks the terminal to set the
+// clipboard. Inside tmux it is wrapped in a DCS passthrough.
+func osc52Sequence(text string, tmux bool) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"
+	if tmux {
+		return "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+// execCommand es un wrapper para exec.Command; es una variable para poder
+// sustituirlo en tests.
+var execCommand = func(name string, arg ...string) *exec.Cmd {
+	return exec.Command(name, arg...)
+}
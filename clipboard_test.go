@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeClipboard stands in for PATH, the environment, the terminal and the
+// commands run; commands listed in fail exit with an error. It returns the
+// command lines run, with what each got on stdin, and what OSC 52 wrote.
+func fakeClipboard(t *testing.T, tools []string, env map[string]string, fail []string, tty bool) (*[]string, *string) {
+	t.Helper()
+	savedLook, savedEnv, savedExec, savedOSC := lookPath, getenv, execCommand, osc52
+	t.Cleanup(func() { lookPath, getenv, execCommand, osc52 = savedLook, savedEnv, savedExec, savedOSC })
+
+	lookPath = func(name string) (string, error) {
+		for _, tool := range tools {
+			if tool == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+	getenv = func(key string) string { return env[key] }
+
+	var ran []string
+	var cmds []*exec.Cmd
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		line := strings.Join(append([]string{name}, arg...), " ")
+		c := exec.Command("true")
+		for _, f := range fail {
+			if f == line {
+				c = exec.Command("false")
+			}
+		}
+		ran = append(ran, line)
+		cmds = append(cmds, c)
+		return c
+	}
+	t.Cleanup(func() {
+		// every command got the text
+		for i, c := range cmds {
+			if c.Stdin == nil {
+				t.Errorf("%s: no stdin", ran[i])
+			}
+		}
+	})
+
+	var wrote string
+	osc52 = nil
+	if tty {
+		osc52 = func(text string) error { wrote = text; return nil }
+	}
+	return &ran, &wrote
+}
+
+func TestCopyToClipboard(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("pbcopy comes first on macOS")
+	}
+	tests := []struct {
+		name    string
+		tools   []string
+		env     map[string]string
+		fail    []string
+		tty     bool
+		want    []string
+		osc52   bool
+		wantErr string
+	}{
+		{
+			name:  "wayland",
+			tools: []string{"wl-copy", "xclip"},
+			env:   map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"},
+			want:  []string{"wl-copy"},
+		},
+		{
+			name:  "xclip",
+			tools: []string{"xclip", "xsel"},
+			env:   map[string]string{"DISPLAY": ":0"},
+			want:  []string{"xclip -selection clipboard"},
+		},
+		{
+			name:  "xsel",
+			tools: []string{"xsel", "wl-copy"},
+			env:   map[string]string{"DISPLAY": ":0"},
+			want:  []string{"xsel --clipboard --input"},
+		},
+		{
+			name:  "xclip fails",
+			tools: []string{"xclip", "xsel"},
+			env:   map[string]string{"DISPLAY": ":0"},
+			fail:  []string{"xclip -selection clipboard"},
+			want:  []string{"xclip -selection clipboard", "xsel --clipboard --input"},
+		},
+		{
+			name:  "tmux",
+			tools: []string{"tmux", "xclip"},
+			env:   map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"},
+			tty:   true,
+			want:  []string{"tmux load-buffer -w -"},
+		},
+		{
+			name:  "old tmux",
+			tools: []string{"tmux"},
+			env:   map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"},
+			fail:  []string{"tmux load-buffer -w -"},
+			want:  []string{"tmux load-buffer -w -", "tmux load-buffer -"},
+		},
+		{
+			name:  "osc52 over ssh",
+			tools: []string{"xclip"},
+			env:   map[string]string{"SSH_TTY": "/dev/pts/0"},
+			tty:   true,
+			osc52: true,
+		},
+		{
+			name:    "nothing",
+			tools:   []string{"xclip", "tmux"},
+			env:     map[string]string{},
+			wantErr: "No clipboard backend available",
+		},
+		{
+			name:    "all fail",
+			tools:   []string{"xclip"},
+			env:     map[string]string{"DISPLAY": ":0"},
+			fail:    []string{"xclip -selection clipboard"},
+			want:    []string{"xclip -selection clipboard"},
+			wantErr: "clipboard failed: xclip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran, wrote := fakeClipboard(t, tt.tools, tt.env, tt.fail, tt.tty)
+			err := copyToClipboard("nmap -sV 10.0.0.1")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("copyToClipboard: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(*ran, tt.want) {
+				t.Errorf("ran %q, want %q", *ran, tt.want)
+			}
+			if got := *wrote == "nmap -sV 10.0.0.1"; got != tt.osc52 {
+				t.Errorf("OSC 52 wrote %q", *wrote)
+			}
+		})
+	}
+}
+
+func TestCopyToClipboardOSC52Error(t *testing.T) {
+	fakeClipboard(t, nil, map[string]string{}, nil, false)
+	osc52 = func(string) error { return errors.New("no tty") }
+	if err := copyToClipboard("x"); err == nil || !strings.Contains(err.Error(), "osc52: no tty") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestOSC52Sequence(t *testing.T) {
+	tests := []struct {
+		tmux bool
+		want string
+	}{
+		{false, "\x1b]52;c;aGk=\x07"},
+		{true, "\x1bPtmux;\x1b\x1b]52;c;aGk=\x07\x1b\\"},
+	}
+	for _, tt := range tests {
+		if got := osc52Sequence("hi", tt.tmux); got != tt.want {
+			t.Errorf("osc52Sequence(tmux=%v) = %q, want %q", tt.tmux, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the user settings read from config.json in the NmapX
+// config directory. Missing fields keep their defaults.
+type Config struct {
+	Explain ExplainConfig `json:"explain"`
+	Redact  RedactConfig  `json:"redact"`
+	Jobs    JobsConfig    `json:"jobs"`
+	Output  OutputConfig  `json:"output"`
+	NSE     NSEConfig     `json:"nse"`
+	Nmap    NmapConfig    `json:"nmap"`
+	Shard   ShardConfig   `json:"shard"`
+	// Theme names the colour theme; Themes adds or replaces themes, see theme.go.
+	Theme  string     `json:"theme"`
+	Themes []Theme    `json:"themes"`
+	Keys   KeysConfig `json:"keys"`
+	// Pipelines appear next to the custom commands; see pipeline.go.
+	Pipelines []Pipeline `json:"pipelines"`
+}
+
+// JobsConfig configures the scan queue.
+type JobsConfig struct {
+	MaxConcurrent int    `json:"max_concurrent"`
+	StatsEvery    string `json:"stats_every"` // --stats-every added to nmap jobs, "" to disable
+}
+
+// ExplainConfig configures the AI explainer used by 'x' and 'R'.
+type ExplainConfig struct {
+	APIURL     string `json:"api_url"`
+	Model      string `json:"model"`
+	APIKeyEnv  string `json:"api_key_env"`
+	MaxRetries int    `json:"max_retries"`
+
+	// Cost accounting: USD per million tokens by model, and an optional
+	// monthly cap after which explain is disabled.
+	Prices           map[string]Price `json:"prices"`
+	MonthlyBudgetUSD float64          `json:"monthly_budget_usd"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Explain: ExplainConfig{
+			APIURL:     apiURL,
+			Model:      "gpt-4o-mini",
+			APIKeyEnv:  "OPENAI_API_KEY",
+			MaxRetries: 3,
+			Prices:     defaultPrices(),
+		},
+		Redact:    defaultRedactConfig(),
+		Jobs:      JobsConfig{MaxConcurrent: 2, StatsEvery: "5s"},
+		Output:    OutputConfig{Dir: "nmapx-scans", AutoOA: true, Relocate: true},
+		Shard:     defaultShardConfig(),
+		Theme:     "blue",
+		Pipelines: defaultPipelines(),
+	}
+}
+
+// configDir devuelve el directorio de configuración (~/.config/nmapx)
+func configDir() string {
+	if dir := os.Getenv("NMAPX_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return ".nmapx"
+	}
+	return filepath.Join(base, "nmapx")
+}
+
+// loadConfig reads config.json on top of the defaults. A missing file is not an error.
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+	data, err := os.ReadFile(filepath.Join(configDir(), "config.json"))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	// json would decode the user's steps over the default ones
+	cfg.Pipelines = nil
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return defaultConfig(), err
+	}
+	if cfg.Pipelines == nil {
+		cfg.Pipelines = defaultPipelines()
+	}
+	return cfg, nil
+}
+
+// engagementRedactFile lets each engagement directory carry its own
+// redaction rules, replacing the "redact" block of config.json.
+const engagementRedactFile = ".nmapx-redact.json"
+
+// loadRedactConfig returns the redaction rules for the current directory.
+func loadRedactConfig(cfg Config) (RedactConfig, error) {
+	data, err := os.ReadFile(engagementRedactFile)
+	if os.IsNotExist(err) {
+		return cfg.Redact, nil
+	}
+	if err != nil {
+		return cfg.Redact, err
+	}
+	rc := defaultRedactConfig()
+	if err := json.Unmarshal(data, &rc); err != nil {
+		return cfg.Redact, fmt.Errorf("%s: %w", engagementRedactFile, err)
+	}
+	return rc, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// OpenAI API endpoint
+const apiURL = "https://api.openai.com/v1/chat/completions"
+
+// ---------- OpenAI payload types ----------
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type RequestBody struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+}
+
+type Choice struct {
+	Message Message `json:"message"`
+}
+
+type ResponseBody struct {
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+}
+
+//-------------------------------------------
+
+const cmdPrompt = "Summarize what this nmap command does in a security context. Be brief and skip any mention that it's an nmap command. Don't explain individual flags. Just describe the overall action and intent. Check if the command is valid or has conflicting options. If it's invalid, suggest a corrected version."
+
+const resultsPrompt = "You are assisting an authorized penetration test. Below is a condensed summary of nmap results: hosts, open ports, service versions and NSE script findings. Identifiers may be replaced by placeholders; keep them as they are. List the most likely vulnerabilities or misconfigurations and give prioritized next steps (highest value first), each with a concrete command or check. Be brief."
+
+// Explainer sends prompts to an OpenAI-compatible chat completions API.
+type Explainer struct {
+	URL    string
+	Model  string
+	KeyEnv string
+	Client *http.Client
+
+	// Redactor, if set, hides sensitive values in the user prompt and
+	// restores them in the answer.
+	Redactor *Redactor
+
+	// Usage, if set, records token counts and enforces the monthly budget.
+	Usage *UsageTracker
+
+	// Rate limits and 5xx are retried up to MaxRetries times, waiting
+	// Retry-After when the server sends it and an exponential backoff
+	// otherwise.
+	MaxRetries int
+	OnRetry    func(attempt int, wait time.Duration, err error)
+	sleep      func(time.Duration)
+}
+
+func newExplainer(cfg ExplainConfig, r *Redactor, u *UsageTracker) *Explainer {
+	return &Explainer{
+		URL:        cfg.APIURL,
+		Model:      cfg.Model,
+		KeyEnv:     cfg.APIKeyEnv,
+		Client:     &http.Client{Timeout: 60 * time.Second},
+		Redactor:   r,
+		Usage:      u,
+		MaxRetries: cfg.MaxRetries,
+		sleep:      time.Sleep,
+	}
+}
+
+// Ask sends one system/user exchange and returns the first choice.
+func (e *Explainer) Ask(system, user string) (string, error) {
+	if err := e.Usage.Allow(e.Model); err != nil {
+		return "", err
+	}
+	user = e.Redactor.Redact(user)
+	for attempt := 0; ; attempt++ {
+		out, usage, err := e.ask(system, user)
+		if err == nil {
+			e.Usage.Record(e.Model, usage)
+			return e.Redactor.Restore(out), nil
+		}
+		wait, retry := e.backoff(attempt, err)
+		if !retry {
+			return "", err
+		}
+		if e.OnRetry != nil {
+			e.OnRetry(attempt+1, wait, err)
+		}
+		e.sleep(wait)
+	}
+}
+
+// maxRetryWait is the longest Retry-After that Ask waits for; a server
+// asking for more gets its rate limit error returned instead.
+const maxRetryWait = time.Minute
+
+// backoff decides whether attempt (0-based) is retried after err, and how long to wait.
+func (e *Explainer) backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt >= e.MaxRetries {
+		return 0, false
+	}
+	var rl *RateLimitError
+	var ae *APIError
+	switch {
+	case errors.As(err, &rl):
+		if rl.RetryAfter > maxRetryWait {
+			return 0, false
+		}
+		if rl.RetryAfter > 0 {
+			return rl.RetryAfter, true
+		}
+	case errors.As(err, &ae) && ae.temporary():
+	default:
+		return 0, false
+	}
+	wait := time.Second << uint(attempt)
+	if wait > 30*time.Second {
+		wait = 30 * time.Second
+	}
+	return wait, true
+}
+
+func (e *Explainer) ask(system, user string) (string, Usage, error) {
+	apiKey := os.Getenv(e.KeyEnv)
+	if apiKey == "" {
+		return "", Usage{}, fmt.Errorf("%w: %s not set", ErrAuth, e.KeyEnv)
+	}
+
+	body := RequestBody{
+		Model: e.Model,
+		Messages: []Message{
+			{"system", system},
+			{"user", user},
+		},
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	req, err := http.NewRequest("POST", e.URL, bytes.NewBuffer(data))
+	if err != nil {
+		return "", Usage{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", Usage{}, statusError(resp, raw)
+	}
+
+	var rb ResponseBody
+	if err := json.Unmarshal(raw, &rb); err != nil {
+		return "", Usage{}, &MalformedResponseError{Status: resp.StatusCode, Body: snippet(raw), Err: err}
+	}
+	if len(rb.Choices) == 0 || rb.Choices[0].Message.Content == "" {
+		return "", Usage{}, &MalformedResponseError{Status: resp.StatusCode, Body: snippet(raw), Err: errors.New("no choices in response")}
+	}
+	return rb.Choices[0].Message.Content, rb.Usage, nil
+}
+
+// explain describe el comando actual en el panel detail
+func explain(app *tview.Application, ex *Explainer, cmdView *tview.TextView, detail *tview.TextView) {
+	cmd := cmdView.GetText(true)
+	ex.Redactor.AddTargets(cmd)
+	askAsync(app, ex, detail, cmdPrompt, cmd)
+}
+
+// explainResults sends a condensed summary of the XML output in path and
+// shows the suggested next steps in detail.
+func explainResults(app *tview.Application, ex *Explainer, path string, detail *tview.TextView) {
+	if path == "" {
+		detail.SetText("No XML output yet - run a job with -oX/-oA output first")
+		return
+	}
+	run, err := parseNmapXML(path)
+	if err != nil {
+		detail.SetText(tview.Escape(err.Error()))
+		return
+	}
+	// short names like "dc01" don't match the redaction patterns
+	for _, h := range run.Hosts {
+		for _, hn := range h.Hostnames {
+			ex.Redactor.AddTerm(hn.Name)
+		}
+	}
+	summary := summarizeResults(run, SummaryOptions{MaxScriptOutput: 300})
+	askAsync(app, ex, detail, resultsPrompt, summary)
+}
+
+// showRetries reports each retry of ex in detail.
+func showRetries(app *tview.Application, ex *Explainer, detail *tview.TextView) {
+	ex.OnRetry = func(attempt int, wait time.Duration, err error) {
+		app.QueueUpdateDraw(func() {
+			detail.SetText(fmt.Sprintf("[yellow]%s[-]\nretry %d/%d in %s…",
+				tview.Escape(err.Error()), attempt, ex.MaxRetries, wait.Round(time.Second)))
+		})
+	}
+}
+
+// askAsync runs Ask off the UI goroutine and shows the outcome in detail.
+func askAsync(app *tview.Application, ex *Explainer, detail *tview.TextView, system, user string) {
+	detail.SetText("Asking…")
+	go func() {
+		out, err := ex.Ask(system, user)
+		app.QueueUpdateDraw(func() {
+			if err != nil {
+				detail.SetText(explainErrorText(err))
+				return
+			}
+			detail.SetText(tview.Escape(out))
+		})
+	}()
+}
+
+// explainErrorText formats an Ask error for the detail pane.
+func explainErrorText(err error) string {
+	var rl *RateLimitError
+	var mr *MalformedResponseError
+	var ae *APIError
+	msg := tview.Escape(err.Error())
+	switch {
+	case errors.Is(err, ErrAuth):
+		return "[red]Authentication failed[-]\n" + msg + "\n\nCheck the API key variable and that the key is still valid."
+	case errors.Is(err, ErrBudget):
+		return "[red]Budget reached[-]\n" + msg + "\n\nRaise monthly_budget_usd in config.json to explain again this month."
+	case errors.Is(err, ErrNoPrice):
+		return "[red]No price for the model[-]\n" + msg + "\n\nWithout a price the budget cannot be checked. Add the model to prices in config.json, or remove monthly_budget_usd."
+	case errors.Is(err, ErrQuota):
+		return "[red]Quota exhausted[-]\n" + msg + "\n\nCheck the plan and billing of the API account."
+	case errors.As(err, &rl):
+		return "[yellow]Rate limited[-]\n" + msg + "\n\nRetries used up, try again in a moment."
+	case errors.As(err, &mr):
+		return "[red]Malformed response[-]\n" + msg + "\n\n" + tview.Escape(mr.Body)
+	case errors.As(err, &ae):
+		return "[red]API error[-]\n" + msg
+	}
+	return "[red]Error[-]\n" + msg
+}
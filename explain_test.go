@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// reply is one canned answer of the stand-in API server.
+type reply struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+const okBody = `{"choices":[{"message":{"role":"assistant","content":"fine"}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+
+// testExplainer points an Explainer at a server that gives the replies in
+// order (the last one again once they run out). It returns the waits
+// Ask would have slept and how many requests the server saw.
+func testExplainer(t *testing.T, replies ...reply) (*Explainer, *[]time.Duration, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		rep := replies[len(replies)-1]
+		if requests < len(replies) {
+			rep = replies[requests]
+		}
+		requests++
+		for k, v := range rep.header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(rep.status)
+		fmt.Fprint(w, rep.body)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("NMAPX_TEST_KEY", "test-key")
+
+	e := newExplainer(ExplainConfig{APIURL: srv.URL, Model: "gpt-4o-mini", APIKeyEnv: "NMAPX_TEST_KEY", MaxRetries: 3}, nil, nil)
+	var waits []time.Duration
+	e.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return e, &waits, &requests
+}
+
+func TestAskUnauthorized(t *testing.T) {
+	e, waits, requests := testExplainer(t, reply{401, nil, `{"error":{"message":"bad key","type":"invalid_request_error"}}`})
+	_, err := e.Ask("sys", "user")
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("err = %v, want ErrAuth", err)
+	}
+	if *requests != 1 || len(*waits) != 0 {
+		t.Errorf("%d requests, waits %v: auth errors are not retried", *requests, *waits)
+	}
+}
+
+func TestAskRateLimitSeconds(t *testing.T) {
+	e, waits, requests := testExplainer(t,
+		reply{429, map[string]string{"Retry-After": "2"}, `{"error":{"message":"slow down"}}`},
+		reply{200, nil, okBody})
+	out, err := e.Ask("sys", "user")
+	if err != nil || out != "fine" {
+		t.Fatalf("Ask = %q, %v", out, err)
+	}
+	if *requests != 2 || len(*waits) != 1 || (*waits)[0] != 2*time.Second {
+		t.Errorf("%d requests, waits %v, want one wait of 2s", *requests, *waits)
+	}
+}
+
+func TestAskRateLimitDate(t *testing.T) {
+	when := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+	e, waits, _ := testExplainer(t,
+		reply{429, map[string]string{"Retry-After": when}, `{"error":{"message":"slow down"}}`},
+		reply{200, nil, okBody})
+	if _, err := e.Ask("sys", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*waits) != 1 || (*waits)[0] < 3*time.Second || (*waits)[0] > 6*time.Second {
+		t.Errorf("waits %v, want about 5s", *waits)
+	}
+}
+
+func TestAskRateLimitTooLong(t *testing.T) {
+	e, waits, requests := testExplainer(t,
+		reply{429, map[string]string{"Retry-After": "3600"}, `{"error":{"message":"come back later"}}`},
+		reply{200, nil, okBody})
+	_, err := e.Ask("sys", "user")
+	var rl *RateLimitError
+	if !errors.As(err, &rl) || rl.RetryAfter != time.Hour {
+		t.Fatalf("err = %v, want a RateLimitError of 1h", err)
+	}
+	if *requests != 1 || len(*waits) != 0 {
+		t.Errorf("%d requests, waits %v: an hour is past the cap", *requests, *waits)
+	}
+}
+
+func TestAskQuota(t *testing.T) {
+	e, _, requests := testExplainer(t, reply{429, nil, `{"error":{"message":"no credit","code":"insufficient_quota"}}`})
+	if _, err := e.Ask("sys", "user"); !errors.Is(err, ErrQuota) {
+		t.Fatalf("err = %v, want ErrQuota", err)
+	}
+	if *requests != 1 {
+		t.Errorf("%d requests, quota errors are not retried", *requests)
+	}
+}
+
+func TestAskServerErrorThenSuccess(t *testing.T) {
+	e, waits, requests := testExplainer(t,
+		reply{500, nil, "internal error"},
+		reply{503, nil, `{"error":{"message":"overloaded"}}`},
+		reply{200, nil, okBody})
+	out, err := e.Ask("sys", "user")
+	if err != nil || out != "fine" {
+		t.Fatalf("Ask = %q, %v", out, err)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second}
+	if *requests != 3 || fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("%d requests, waits %v, want 3 and %v", *requests, *waits, want)
+	}
+}
+
+func TestAskServerErrorGivesUp(t *testing.T) {
+	e, waits, requests := testExplainer(t, reply{502, nil, "bad gateway"})
+	_, err := e.Ask("sys", "user")
+	var ae *APIError
+	if !errors.As(err, &ae) || ae.Status != 502 {
+		t.Fatalf("err = %v, want APIError 502", err)
+	}
+	if *requests != 4 || len(*waits) != 3 {
+		t.Errorf("%d requests, waits %v, want 1 + MaxRetries", *requests, *waits)
+	}
+}
+
+func TestAskMalformed(t *testing.T) {
+	tests := []string{"<html>proxy</html>", `{"choices":[]}`}
+	for _, body := range tests {
+		e, waits, _ := testExplainer(t, reply{200, nil, body})
+		_, err := e.Ask("sys", "user")
+		var me *MalformedResponseError
+		if !errors.As(err, &me) {
+			t.Errorf("body %q: err = %v, want MalformedResponseError", body, err)
+		}
+		if len(*waits) != 0 {
+			t.Errorf("body %q: retried %v", body, *waits)
+		}
+	}
+}
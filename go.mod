@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/gdamore/tcell/v2 v2.7.1
 	github.com/rivo/tview v0.0.0-20250501113434-0c592cd31026
+	go.etcd.io/bbolt v1.3.9
 )
 
 require (
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// importPage is a file picker for nmap output files to import.
+type importPage struct {
+	*tview.Flex
+	list     *tview.List
+	status   *tview.TextView
+	dir      string
+	entries  []os.DirEntry // same order as list items, after ".."
+	marked   map[string]bool
+	onImport func(paths []string)
+}
+
+// nmapOutputExt are the extensions -oA gives each format.
+var nmapOutputExt = map[string]bool{".xml": true, ".gnmap": true, ".nmap": true, ".json": true}
+
+func newImportPage(onImport func(paths []string)) *importPage {
+	p := &importPage{
+		list:     tview.NewList().ShowSecondaryText(false),
+		status:   tview.NewTextView().SetDynamicColors(true),
+		marked:   make(map[string]bool),
+		onImport: onImport,
+	}
+	p.list.SetBorder(true)
+	themed(p.list, themeAccent)
+	p.list.SetSelectedFunc(func(i int, _, _ string, _ rune) { p.open(i) })
+
+	p.status.SetBorder(true).SetTitle("Import")
+	themed(p.status, themePlain)
+
+	help := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	help.SetBorder(true).SetTitle("Import nmap output")
+	themed(help, themePlain)
+	help.SetText("◀ Enter open/import | " + keymap.Help("import_mark", "mark", "import_mark_all", "mark all nmap files") +
+		" | " + keymap.Label("import") + "/" + keymap.Label("back") + " back ▶")
+
+	p.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(help, 3, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(p.list, 0, 2, true).
+			AddItem(p.status, 0, 1, false), 0, 1, true)
+	themed(p.Flex, themePlain)
+	return p
+}
+
+// show lists dir, keeping marks made elsewhere.
+func (p *importPage) show(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		p.status.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].IsDir() && !entries[j].IsDir() })
+	p.dir, p.entries = dir, entries
+	p.list.SetTitle(" " + dir + " ")
+	p.redraw()
+	p.list.SetCurrentItem(0)
+}
+
+func (p *importPage) redraw() {
+	cur := p.list.GetCurrentItem()
+	p.list.Clear()
+	p.list.AddItem("../", "", 0, nil)
+	for _, e := range p.entries {
+		label := e.Name()
+		switch {
+		case e.IsDir():
+			label = tview.Escape(label) + "/"
+		case p.marked[filepath.Join(p.dir, e.Name())]:
+			label = "✓ " + tview.Escape(label)
+		case nmapOutputExt[filepath.Ext(label)]:
+			label = "  [green]" + tview.Escape(label) + "[-]"
+		default:
+			label = "  " + tview.Escape(label)
+		}
+		p.list.AddItem(label, "", 0, nil)
+	}
+	p.list.SetCurrentItem(cur)
+	p.showMarked()
+}
+
+func (p *importPage) showMarked() {
+	if len(p.marked) == 0 {
+		p.status.SetText("Mark files with Space, or press Enter on a file to import it.\n\n-oX, -oG and -oN output is recognised by content; the files of one -oA scan are merged.")
+		return
+	}
+	names := p.markedPaths()
+	p.status.SetText(fmt.Sprintf("%d marked - Enter imports them\n\n%s", len(names), tview.Escape(strings.Join(names, "\n"))))
+}
+
+// entry returns the list item i, nil for "..".
+func (p *importPage) entry(i int) os.DirEntry {
+	if i < 1 || i > len(p.entries) {
+		return nil
+	}
+	return p.entries[i-1]
+}
+
+func (p *importPage) open(i int) {
+	e := p.entry(i)
+	switch {
+	case e == nil:
+		p.show(filepath.Dir(p.dir))
+	case e.IsDir():
+		p.show(filepath.Join(p.dir, e.Name()))
+	default:
+		paths := p.markedPaths()
+		if len(paths) == 0 {
+			paths = []string{filepath.Join(p.dir, e.Name())}
+		}
+		p.marked = make(map[string]bool)
+		p.redraw()
+		p.status.SetText("Importing…")
+		p.onImport(paths)
+	}
+}
+
+func (p *importPage) markedPaths() []string {
+	var paths []string
+	for path := range p.marked {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// handleAction runs the keymap actions of the import page.
+func (p *importPage) handleAction(action string) {
+	switch action {
+	case "import_mark":
+		if e := p.entry(p.list.GetCurrentItem()); e != nil && !e.IsDir() {
+			path := filepath.Join(p.dir, e.Name())
+			if p.marked[path] {
+				delete(p.marked, path)
+			} else {
+				p.marked[path] = true
+			}
+			p.redraw()
+		}
+	case "import_mark_all":
+		for _, e := range p.entries {
+			if !e.IsDir() && nmapOutputExt[filepath.Ext(e.Name())] {
+				p.marked[filepath.Join(p.dir, e.Name())] = true
+			}
+		}
+		p.redraw()
+	}
+}
+
+// done shows the outcome of an import.
+func (p *importPage) done(results []ImportResult, err error) {
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "[green]%d hosts[-] %s (%s", r.Hosts, tview.Escape(filepath.Base(r.Source)), r.Format)
+		if len(r.Files) > 1 {
+			fmt.Fprintf(&b, ", merged from %d files", len(r.Files))
+		}
+		b.WriteString(")\n")
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "[red]%s[-]\n", tview.Escape(err.Error()))
+	} else {
+		b.WriteString("\nPress " + keymap.Label("results_db") + " on the main screen to query the results.")
+	}
+	p.status.SetText(b.String())
+}
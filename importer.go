@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- importing nmap output files ----------
+
+// Formats understood by parseNmapFile.
+const (
+	formatXML      = "xml"
+	formatGrepable = "grepable"
+	formatNormal   = "normal"
+	formatMasscan  = "masscan"  // -oJ
+	formatNaabu    = "naabu"    // -json
+	formatRustscan = "rustscan" // -g
+)
+
+var (
+	// # Nmap 7.94 scan initiated Mon May  5 14:27:09 2025 as: nmap -sV -oA scan 10.0.0.5
+	initiatedRe = regexp.MustCompile(`^# Nmap \S+ scan initiated (.+?) as: (.*)$`)
+	// Host: 10.0.0.5 (dc01.acme.local)	Ports: 22/open/tcp//ssh//OpenSSH 8.2p1/
+	gnmapHostRe = regexp.MustCompile(`^Host: (\S+) \(([^)]*)\)\t(.*)$`)
+	// Starting Nmap 7.94 ( https://nmap.org ) at 2025-05-05 14:27 CEST
+	startingRe = regexp.MustCompile(`^Starting Nmap \S+ \( \S+ \) at (\d{4}-\d\d-\d\d \d\d:\d\d)`)
+	// Nmap scan report for dc01.acme.local (10.0.0.5)
+	reportForRe = regexp.MustCompile(`^Nmap scan report for (\S+)(?: \((\S+)\))?`)
+	// 22/tcp   open  ssh     OpenSSH 8.2p1 Ubuntu
+	normalPortRe = regexp.MustCompile(`^(\d+)/(tcp|udp|sctp)\s+(\S+)\s+(\S+)(?:\s+(.*))?$`)
+	// | http-title: Welcome  or  |_ssh-hostkey: ...
+	scriptStartRe = regexp.MustCompile(`^\|[ _]([A-Za-z0-9][\w.-]*):\s?(.*)$`)
+)
+
+// parseNmapFile reads -oX, -oG or -oN output, or the output of the other
+// backends. Grepable and normal output carry less than XML, and the other
+// scanners only report open ports, so what cannot be recovered is left empty.
+func parseNmapFile(path string) (*NmapRun, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var run *NmapRun
+	format := detectFormat(data)
+	switch format {
+	case formatXML:
+		run = &NmapRun{}
+		err = xml.Unmarshal(data, run)
+	case formatGrepable:
+		run, err = parseGrepable(data)
+	case formatNormal:
+		run, err = parseNormal(data)
+	case formatMasscan:
+		run, err = parseMasscanJSON(data)
+	case formatNaabu:
+		run, err = parseNaabuJSON(data)
+	case formatRustscan:
+		run, err = parseRustscanGreppable(data)
+	default:
+		return nil, "", fmt.Errorf("%s: not nmap, masscan, naabu or rustscan output", path)
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("%s: %w", path, err)
+	}
+	dedupeHosts(run)
+	return run, format, nil
+}
+
+func detectFormat(data []byte) string {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<nmaprun")):
+		return formatXML
+	case bytes.Contains(data, []byte("\nHost: ")) || bytes.HasPrefix(data, []byte("Host: ")):
+		return formatGrepable
+	case bytes.Contains(data, []byte("Nmap scan report for ")):
+		return formatNormal
+	}
+	return detectBackendFormat(data)
+}
+
+// scanHeader reads the "# Nmap ... scan initiated" comment line, or the
+// "Starting Nmap" banner of captured terminal output.
+func scanHeader(run *NmapRun, line string) bool {
+	if m := startingRe.FindStringSubmatch(line); m != nil {
+		if t, err := time.ParseInLocation("2006-01-02 15:04", m[1], time.Local); err == nil && run.Start == 0 {
+			run.Start = t.Unix()
+		}
+		return true
+	}
+	m := initiatedRe.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	if t, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006", m[1], time.Local); err == nil {
+		run.Start = t.Unix()
+	}
+	run.Args = m[2]
+	return true
+}
+
+func newImportedHost(addr, hostname string) Host {
+	typ := "ipv4"
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		typ = "ipv6"
+	}
+	h := Host{Addresses: []Address{{Addr: addr, AddrType: typ}}}
+	if hostname != "" {
+		h.Hostnames = []Hostname{{Name: hostname, Type: "user"}}
+	}
+	return h
+}
+
+// parseGrepable reads -oG output. Each host can appear on several lines
+// (Status, Ports); dedupeHosts joins them.
+func parseGrepable(data []byte) (*NmapRun, error) {
+	run := &NmapRun{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if scanHeader(run, line) {
+			continue
+		}
+		m := gnmapHostRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		h := newImportedHost(m[1], m[2])
+		for _, field := range strings.Split(m[3], "\t") {
+			key, val, _ := strings.Cut(field, ": ")
+			switch key {
+			case "Status":
+				h.Status.State = strings.ToLower(val)
+			case "Ports":
+				h.Ports = append(h.Ports, grepablePorts(val)...)
+				h.Status.State = "up"
+			}
+		}
+		run.Hosts = append(run.Hosts, h)
+	}
+	return run, sc.Err()
+}
+
+// grepablePorts parses "22/open/tcp//ssh//OpenSSH 8.2p1/, 80/open/tcp//http///".
+func grepablePorts(s string) []Port {
+	var ports []Port
+	for _, entry := range strings.Split(s, "/, ") {
+		f := strings.Split(strings.TrimSuffix(entry, "/"), "/")
+		if len(f) < 3 {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(f[0]))
+		if err != nil {
+			continue
+		}
+		p := Port{PortID: n, Protocol: f[2], State: PortState{State: f[1]}}
+		if len(f) > 4 {
+			p.Service.Name = f[4]
+		}
+		if len(f) > 6 {
+			p.Service.Product = f[6]
+		}
+		ports = append(ports, p)
+	}
+	return ports
+}
+
+// parseNormal reads -oN (or captured terminal) output, including NSE
+// script results.
+func parseNormal(data []byte) (*NmapRun, error) {
+	run := &NmapRun{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var host *Host
+	var script *Script
+	hostScripts := false
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if scanHeader(run, line) {
+			continue
+		}
+		if m := reportForRe.FindStringSubmatch(line); m != nil {
+			addr, name := m[1], ""
+			if m[2] != "" {
+				addr, name = m[2], m[1]
+			}
+			run.Hosts = append(run.Hosts, newImportedHost(addr, name))
+			host, script, hostScripts = &run.Hosts[len(run.Hosts)-1], nil, false
+			continue
+		}
+		if host == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "Host is up"):
+			host.Status.State = "up"
+		case strings.HasPrefix(line, "Host seems down"):
+			host.Status.State = "down"
+		case line == "Host script results:":
+			hostScripts, script = true, nil
+		case normalPortRe.MatchString(line):
+			m := normalPortRe.FindStringSubmatch(line)
+			n, _ := strconv.Atoi(m[1])
+			host.Ports = append(host.Ports, Port{
+				PortID:   n,
+				Protocol: m[2],
+				State:    PortState{State: m[3]},
+				Service:  Service{Name: m[4], Product: m[5]},
+			})
+			script = nil
+		case strings.HasPrefix(line, "|"):
+			var scripts *[]Script
+			switch {
+			case hostScripts:
+				scripts = &host.HostScripts
+			case len(host.Ports) > 0:
+				scripts = &host.Ports[len(host.Ports)-1].Scripts
+			default:
+				continue
+			}
+			if m := scriptStartRe.FindStringSubmatch(line); m != nil {
+				*scripts = append(*scripts, Script{ID: m[1], Output: m[2]})
+				script = &(*scripts)[len(*scripts)-1]
+			} else if script != nil {
+				script.Output += "\n" + strings.TrimLeft(line[1:], "_ ")
+			}
+		}
+	}
+	return run, sc.Err()
+}
+
+// dedupeHosts joins records of the same address: ports are merged, a later
+// entry for the same port replaces an earlier one.
+func dedupeHosts(run *NmapRun) {
+	var out []Host
+	index := make(map[string]int)
+	for _, h := range run.Hosts {
+		addr := h.Addr()
+		i, seen := index[addr]
+		if !seen || addr == "" {
+			index[addr] = len(out)
+			out = append(out, h)
+			continue
+		}
+		out[i] = mergeHost(out[i], h)
+	}
+	run.Hosts = out
+}
+
+// mergeHost returns a with the information of b added; b wins on conflicts.
+// Script output and service details b lacks are kept from a.
+func mergeHost(a, b Host) Host {
+	if b.Status.State != "" {
+		a.Status = b.Status
+	}
+	if b.StartTime != 0 && (a.StartTime == 0 || b.StartTime < a.StartTime) {
+		a.StartTime = b.StartTime
+	}
+	if b.EndTime > a.EndTime {
+		a.EndTime = b.EndTime
+	}
+	a.Other = mergeOther(a.Other, b.Other)
+	// the counts only make sense for the scan that made them
+	if len(b.ExtraPorts) > 0 {
+		a.ExtraPorts = b.ExtraPorts
+	}
+	names := make(map[string]bool)
+	for _, hn := range a.Hostnames {
+		names[hn.Name] = true
+	}
+	for _, hn := range b.Hostnames {
+		if !names[hn.Name] {
+			a.Hostnames = append(a.Hostnames, hn)
+		}
+	}
+	ports := make(map[string]int)
+	merged := append([]Port(nil), a.Ports...)
+	for i, p := range merged {
+		ports[fmt.Sprintf("%d/%s", p.PortID, p.Protocol)] = i
+	}
+	for _, p := range b.Ports {
+		key := fmt.Sprintf("%d/%s", p.PortID, p.Protocol)
+		if i, ok := ports[key]; ok {
+			// a later scan without -sV only guesses the service
+			if old := merged[i].Service; p.Service.Product == "" && old.Product != "" && (p.Service.Name == "" || p.Service.Name == old.Name) {
+				p.Service = old
+			}
+			p.Scripts = mergeScripts(merged[i].Scripts, p.Scripts)
+			merged[i] = p
+			continue
+		}
+		ports[key] = len(merged)
+		merged = append(merged, p)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Protocol != merged[j].Protocol {
+			return merged[i].Protocol < merged[j].Protocol
+		}
+		return merged[i].PortID < merged[j].PortID
+	})
+	a.Ports = merged
+	a.HostScripts = mergeScripts(a.HostScripts, b.HostScripts)
+	return a
+}
+
+// mergeOther joins the elements NmapX keeps as read by name: b's <times>
+// replaces a's, while the <os> of an earlier -O scan stays.
+func mergeOther(a, b []rawElement) []rawElement {
+	out := append([]rawElement(nil), a...)
+	for _, el := range b {
+		replaced := false
+		for i := range out {
+			if out[i].XMLName.Local == el.XMLName.Local {
+				out[i], replaced = el, true
+			}
+		}
+		if !replaced {
+			out = append(out, el)
+		}
+	}
+	return out
+}
+
+// mergeScripts joins script results by id; b's output replaces a's.
+func mergeScripts(a, b []Script) []Script {
+	if len(a) == 0 {
+		return b
+	}
+	out := append([]Script(nil), a...)
+	for _, s := range b {
+		replaced := false
+		for i := range out {
+			if out[i].ID == s.ID {
+				out[i], replaced = s, true
+			}
+		}
+		if !replaced {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ImportResult reports what one import did.
+type ImportResult struct {
+	Source string   // first file of the scan
+	Files  []string // all files of the same scan
+	Format string
+	Hosts  int
+}
+
+// importFiles parses nmap output files and stores them.
+func importFiles(db *ResultsDB, paths []string) ([]ImportResult, error) {
+	runs, results, err := parseNmapFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	for i, run := range runs {
+		n, err := db.Store(run, results[i].Source)
+		if err != nil {
+			return results[:i], err
+		}
+		results[i].Hosts = n
+	}
+	return results, nil
+}
+
+// parseNmapFiles parses nmap output files. Files from the same scan (the
+// .xml, .gnmap and .nmap of one -oA, for example) are merged into one run
+// with one entry per host, preferring the richest format. A scan is known
+// by its start time and command line: shards and other parallel jobs often
+// start in the same second.
+func parseNmapFiles(paths []string) ([]*NmapRun, []ImportResult, error) {
+	type parsed struct {
+		path, format string
+		run          *NmapRun
+	}
+	var files []parsed
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		run, format, err := parseNmapFile(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, parsed{p, format, run})
+	}
+	// XML last so that it wins when hosts are merged
+	rank := map[string]int{formatGrepable: 0, formatNormal: 1, formatXML: 2}
+	sort.SliceStable(files, func(i, j int) bool { return rank[files[i].format] < rank[files[j].format] })
+
+	var results []ImportResult
+	type scanKey struct {
+		start int64
+		args  string
+	}
+	byScan := make(map[scanKey]int) // scan → index in results/runs
+	var runs []*NmapRun
+	for _, f := range files {
+		key := scanKey{f.run.Start, f.run.Args}
+		i, ok := byScan[key]
+		if !ok || f.run.Start == 0 {
+			byScan[key] = len(runs)
+			runs = append(runs, f.run)
+			results = append(results, ImportResult{Source: f.path, Files: []string{f.path}, Format: f.format})
+			continue
+		}
+		runs[i].Hosts = append(runs[i].Hosts, f.run.Hosts...)
+		dedupeHosts(runs[i])
+		results[i].Files = append(results[i].Files, f.path)
+		results[i].Source, results[i].Format = f.path, f.format
+	}
+	for i, run := range runs {
+		results[i].Hosts = len(run.Hosts)
+	}
+	return runs, results, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNmapFilesGroupsByScan(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 12, 10, 15, 2, 0, time.Local)
+	xmlScan := func(args, addr string) string {
+		return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="%s" start="%d" version="7.94" xmloutputversion="1.05">
+<host><status state="up" reason="arp-response"/><address addr="%s" addrtype="ipv4"/>
+<ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/><service name="ssh"/></port></ports></host>
+<runstats><finished time="%d"/><hosts up="1" down="0" total="1"/></runstats>
+</nmaprun>
+`, args, start.Unix(), addr, start.Unix()+5)
+	}
+	shard1 := "nmap -sS -oA shard-01 10.0.0.0/25"
+	shard2 := "nmap -sS -oA shard-02 10.0.0.128/25"
+	files := map[string]string{
+		// two shards started in the same second
+		"shard-01.xml": xmlScan(shard1, "10.0.0.5"),
+		"shard-02.xml": xmlScan(shard2, "10.0.0.130"),
+		// and the grepable output of the first
+		"shard-01.gnmap": fmt.Sprintf("# Nmap 7.94 scan initiated %s as: %s\nHost: 10.0.0.5 ()\tStatus: Up\nHost: 10.0.0.5 ()\tPorts: 22/open/tcp//ssh///\n# Nmap done at %s -- 128 IP addresses (1 host up) scanned in 5.00 seconds\n",
+			start.Format("Mon Jan _2 15:04:05 2006"), shard1, start.Add(5*time.Second).Format("Mon Jan _2 15:04:05 2006")),
+	}
+	var paths []string
+	for _, name := range []string{"shard-01.gnmap", "shard-01.xml", "shard-02.xml"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	runs, results, err := parseNmapFiles(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("%d scans, want 2: %+v", len(runs), results)
+	}
+	want := []struct {
+		args  string
+		files []string
+		hosts []string
+	}{
+		{shard1, []string{"shard-01.gnmap", "shard-01.xml"}, []string{"10.0.0.5"}},
+		{shard2, []string{"shard-02.xml"}, []string{"10.0.0.130"}},
+	}
+	for i, w := range want {
+		var names, hosts []string
+		for _, f := range results[i].Files {
+			names = append(names, filepath.Base(f))
+		}
+		for _, h := range runs[i].Hosts {
+			hosts = append(hosts, h.Addr())
+		}
+		if runs[i].Args != w.args || !reflect.DeepEqual(names, w.files) || !reflect.DeepEqual(hosts, w.hosts) {
+			t.Errorf("scan %d: args %q, files %q, hosts %q; want %q, %q, %q", i, runs[i].Args, names, hosts, w.args, w.files, w.hosts)
+		}
+	}
+	if results[0].Format != formatXML {
+		t.Errorf("format = %q, want the XML to win", results[0].Format)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobState is the lifecycle of a queued command.
+type JobState int
+
+const (
+	JobQueued JobState = iota
+	JobRunning
+	JobPaused
+	JobDone
+	JobFailed
+	JobCancelled
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobPaused:
+		return "paused"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	case JobCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Finished reports whether the job will not change state again.
+func (s JobState) Finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+// Job is one command run by the JobManager.
+type Job struct {
+	ID   int
+	Name string
+	Cmd  string
+	Args []string
+
+	mu       sync.Mutex
+	state    JobState
+	err      error
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	output   bytes.Buffer
+	stdin    string // e.g. the sudo password; never shown, dropped once the job finishes
+	partial  []byte // output after the last newline, not yet parsed
+	progress Progress
+	proc     *exec.Cmd
+	dropped  bool       // output lost its head to maxJobOutput
+	stopping bool       // cancel or kill sent; the state changes once it exits
+	then     func(*Job) // called once the job has finished
+}
+
+// JobOption configures a job before it is queued.
+type JobOption func(*Job)
+
+// Then makes fn run once the job has finished, whatever its final state,
+// from the goroutine that waited for it. Resumed scans keep it.
+func Then(fn func(*Job)) JobOption {
+	return func(j *Job) { j.then = fn }
+}
+
+// State returns the job's current state and, for failed jobs, the error.
+func (j *Job) State() (JobState, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state, j.err
+}
+
+// Stopping reports whether the job was told to stop and has not exited yet.
+func (j *Job) Stopping() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stopping && !j.state.Finished()
+}
+
+// maxJobOutput caps the output kept per job; older lines are dropped so a
+// long verbose scan neither grows without bound nor slows the jobs page.
+const maxJobOutput = 256 << 10
+
+// Output returns the last maxJobOutput bytes the command has written, from
+// the start of a line.
+func (j *Job) Output() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.dropped {
+		return "[earlier output dropped]\n" + j.output.String()
+	}
+	return j.output.String()
+}
+
+// Elapsed is the run time so far, or the total once finished.
+func (j *Job) Elapsed() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case j.started.IsZero():
+		return 0
+	case j.finished.IsZero():
+		return time.Since(j.started)
+	}
+	return j.finished.Sub(j.started)
+}
+
+// Progress returns the latest progress parsed from nmap's --stats-every output.
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.partial = append(j.partial, p...)
+	for {
+		i := bytes.IndexByte(j.partial, '\n')
+		if i < 0 {
+			break
+		}
+		j.progress.update(string(j.partial[:i]))
+		j.partial = j.partial[i+1:]
+	}
+	j.output.Write(p)
+	if over := j.output.Len() - maxJobOutput; over > 0 {
+		if i := bytes.IndexByte(j.output.Bytes()[over:], '\n'); i >= 0 {
+			over += i + 1
+		}
+		j.output.Next(over)
+		j.dropped = true
+	}
+	return len(p), nil
+}
+
+// JobManager runs queued commands with at most limit running at once.
+type JobManager struct {
+	// OnChange is called, outside the manager's lock, whenever a job changes state.
+	OnChange func(*Job)
+	// OnFinish is called once when a job's process has exited, from the
+	// goroutine that waited for it.
+	OnFinish func(*Job)
+
+	mu         sync.Mutex
+	jobs       []*Job
+	limit      int
+	statsEvery string
+	running    int
+	nextID     int
+}
+
+func newJobManager(cfg JobsConfig) *JobManager {
+	limit := cfg.MaxConcurrent
+	if limit < 1 {
+		limit = 1
+	}
+	return &JobManager{limit: limit, statsEvery: cfg.StatsEvery, nextID: 1}
+}
+
+// Add queues a command line and starts it when a slot is free.
+func (m *JobManager) Add(name, cmdline string, opts ...JobOption) (*Job, error) {
+	args, err := splitArgs(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	return m.add(name, args, "", opts)
+}
+
+// AddSudo queues a command to run through sudo. An empty password means
+// sudo's cached credentials are used and it must not prompt.
+func (m *JobManager) AddSudo(name, cmdline, password string, opts ...JobOption) (*Job, error) {
+	args, err := splitArgs(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	stdin := ""
+	if password != "" {
+		stdin = password + "\n"
+	}
+	return m.add(name, sudoArgs(args, password != ""), stdin, opts)
+}
+
+func (m *JobManager) add(name string, args []string, stdin string, opts []JobOption) (*Job, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	args = injectStats(args, m.statsEvery)
+	m.mu.Lock()
+	j := &Job{ID: m.nextID, Name: name, Cmd: joinArgs(args), Args: args, stdin: stdin, created: time.Now()}
+	for _, o := range opts {
+		o(j)
+	}
+	m.nextID++
+	m.jobs = append(m.jobs, j)
+	m.mu.Unlock()
+
+	m.changed(j)
+	m.schedule()
+	return j, nil
+}
+
+// Jobs returns a snapshot of all jobs in the order they were added.
+func (m *JobManager) Jobs() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Job(nil), m.jobs...)
+}
+
+// Cancel drops a queued job or interrupts a running one with SIGINT, which
+// lets nmap flush its output files.
+func (m *JobManager) Cancel(j *Job) error {
+	return m.stop(j, interruptProcess)
+}
+
+// Kill drops a queued job or kills a running one immediately, also one
+// that was cancelled but has not exited.
+func (m *JobManager) Kill(j *Job) error {
+	return m.stop(j, killProcess)
+}
+
+func (m *JobManager) stop(j *Job, signal func(*exec.Cmd, string) error) error {
+	j.mu.Lock()
+	switch j.state {
+	case JobQueued:
+		j.state = JobCancelled
+		j.finished = time.Now()
+		j.mu.Unlock()
+		m.changed(j)
+		return nil
+	case JobRunning, JobPaused:
+		// the state stays until the process exits: finish makes it
+		// cancelled, and until then a kill can follow a cancel
+		proc, stdin, paused, was := j.proc, j.stdin, j.state == JobPaused, j.stopping
+		j.stopping = true
+		j.mu.Unlock()
+		if proc == nil {
+			return nil // start sees stopping and never launches it
+		}
+		err := signal(proc, stdin)
+		if err == nil && paused {
+			// a stopped process only acts on the signal once continued
+			err = continueProcess(proc, stdin)
+		}
+		if err != nil {
+			j.mu.Lock()
+			j.stopping = was
+			j.mu.Unlock()
+			return err
+		}
+		m.changed(j)
+		return nil
+	}
+	st := j.state
+	j.mu.Unlock()
+	return fmt.Errorf("job %d already %s", j.ID, st)
+}
+
+// Pause stops a running job with SIGSTOP; Resume continues it.
+func (m *JobManager) Pause(j *Job) error {
+	return m.toggle(j, JobRunning, JobPaused, pauseProcess)
+}
+
+func (m *JobManager) Resume(j *Job) error {
+	return m.toggle(j, JobPaused, JobRunning, continueProcess)
+}
+
+func (m *JobManager) toggle(j *Job, from, to JobState, signal func(*exec.Cmd, string) error) error {
+	j.mu.Lock()
+	if j.state != from || j.proc == nil {
+		st := j.state
+		j.mu.Unlock()
+		return fmt.Errorf("job %d is %s, not %s", j.ID, st, from)
+	}
+	if err := signal(j.proc, j.stdin); err != nil {
+		j.mu.Unlock()
+		return err
+	}
+	j.state = to
+	j.mu.Unlock()
+	m.changed(j)
+	return nil
+}
+
+// ResumeScan queues "nmap --resume <log>" for an interrupted job whose
+// command wrote normal (-oN) or grepable (-oG) output.
+func (m *JobManager) ResumeScan(j *Job) (*Job, error) {
+	if st, _ := j.State(); st != JobCancelled && st != JobFailed {
+		return nil, fmt.Errorf("job %d is %s; only interrupted scans can be resumed", j.ID, st)
+	}
+	log := resumeLogPath(j.Args)
+	if log == "" {
+		return nil, fmt.Errorf("job %d has no -oN/-oG/-oA output to resume from", j.ID)
+	}
+	if _, err := os.Stat(log); err != nil {
+		return nil, err
+	}
+	// sudo and other wrappers before nmap are kept
+	var prefix []string
+	for i, a := range j.Args {
+		if filepath.Base(a) == "nmap" {
+			prefix = j.Args[:i+1]
+			break
+		}
+	}
+	if prefix == nil {
+		return nil, fmt.Errorf("job %d is not an nmap scan", j.ID)
+	}
+	args := append(append([]string(nil), prefix...), "--resume", log)
+	then := Then(j.then)
+	if prefix[0] == "sudo" {
+		// the password is gone with the first run: sudo's cached
+		// credentials, still fresh after it, must do
+		args = sudoArgs(append([]string{prefix[len(prefix)-1]}, "--resume", log), false)
+		return m.add(j.Name+" (resumed)", args, "", []JobOption{then})
+	}
+	return m.Add(j.Name+" (resumed)", joinArgs(args), then)
+}
+
+// resumeLogPath returns the output file nmap --resume can read, or "".
+func resumeLogPath(args []string) string {
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-oN", "-oG":
+			return args[i+1]
+		case "-oA":
+			return args[i+1] + ".gnmap"
+		}
+	}
+	return ""
+}
+
+// LatestXML returns the XML output of the most recently finished job that
+// wrote one, or "".
+func (m *JobManager) LatestXML() string {
+	jobs := m.Jobs()
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if st, _ := jobs[i].State(); st != JobDone {
+			continue
+		}
+		if path := outputXMLPath(jobs[i].Cmd); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// StopAll cancels every queued and running job, e.g. when NmapX exits.
+func (m *JobManager) StopAll() {
+	for _, j := range m.Jobs() {
+		if st, _ := j.State(); !st.Finished() {
+			_ = m.Cancel(j)
+		}
+	}
+}
+
+// schedule starts queued jobs while there are free slots.
+func (m *JobManager) schedule() {
+	for {
+		m.mu.Lock()
+		if m.running >= m.limit {
+			m.mu.Unlock()
+			return
+		}
+		var next *Job
+		for _, j := range m.jobs {
+			j.mu.Lock()
+			if j.state == JobQueued {
+				next = j
+				j.state = JobRunning
+				j.started = time.Now()
+			}
+			j.mu.Unlock()
+			if next != nil {
+				break
+			}
+		}
+		if next == nil {
+			m.mu.Unlock()
+			return
+		}
+		m.running++
+		m.mu.Unlock()
+
+		if err := m.start(next); err != nil {
+			m.finish(next, err)
+			continue
+		}
+		m.changed(next)
+		go m.wait(next)
+	}
+}
+
+func (m *JobManager) start(j *Job) error {
+	c := execCommand(j.Args[0], j.Args[1:]...)
+	c.Stdout = j
+	c.Stderr = j
+	setProcessGroup(c)
+	if j.stdin != "" {
+		c.Stdin = strings.NewReader(j.stdin)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stopping {
+		return fmt.Errorf("cancelled before start")
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+	j.proc = c
+	return nil
+}
+
+func (m *JobManager) wait(j *Job) {
+	m.finish(j, j.proc.Wait())
+	m.schedule()
+}
+
+// finish records the exit of a running job and frees its slot.
+func (m *JobManager) finish(j *Job, err error) {
+	j.mu.Lock()
+	j.finished = time.Now()
+	j.stdin = ""
+	switch {
+	case j.state == JobCancelled:
+	case j.stopping:
+		j.state = JobCancelled
+	case err != nil:
+		j.state = JobFailed
+		j.err = err
+	default:
+		j.state = JobDone
+	}
+	j.mu.Unlock()
+
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+	m.changed(j)
+	if m.OnFinish != nil {
+		m.OnFinish(j)
+	}
+	if j.then != nil {
+		j.then(j)
+	}
+}
+
+func (m *JobManager) changed(j *Job) {
+	if m.OnChange != nil {
+		m.OnChange(j)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJobWrite(t *testing.T) {
+	j := &Job{}
+	// a progress line split across writes is parsed once complete
+	for _, chunk := range []string{"SYN Stealth Scan Timing: About 4", "2.00% done; ETC: 14:02 (0:01:25 remaining)\nNmap"} {
+		if n, err := j.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if pr := j.Progress(); pr.Percent != 42 || pr.Phase != "SYN Stealth Scan" {
+		t.Errorf("progress = %+v", pr)
+	}
+
+	// past maxJobOutput only the tail is kept, from the start of a line
+	for i, n := 0, 0; n < 2*maxJobOutput; i++ {
+		w, _ := fmt.Fprintf(j, "Discovered open port %d/tcp on 10.0.0.1\n", i)
+		n += w
+	}
+	out := j.Output()
+	if len(out) > maxJobOutput+len("[earlier output dropped]\n") {
+		t.Errorf("output is %d bytes, want at most %d", len(out), maxJobOutput)
+	}
+	lines := strings.Split(out, "\n")
+	if lines[0] != "[earlier output dropped]" || !strings.HasPrefix(lines[1], "Discovered open port ") {
+		t.Errorf("output starts with %q", lines[:2])
+	}
+	if !strings.HasSuffix(out, "\n") {
+		t.Errorf("output lost its last line: %q", out[len(out)-40:])
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// jobsPage lists queued and running commands with the output of the selected one.
+type jobsPage struct {
+	*tview.Flex
+	app    *tview.Application
+	mgr    *JobManager
+	list   *tview.List
+	output *tview.TextView
+	jobs   []*Job // same order as list items
+}
+
+func newJobsPage(app *tview.Application, mgr *JobManager) *jobsPage {
+	p := &jobsPage{
+		app:    app,
+		mgr:    mgr,
+		list:   tview.NewList().ShowSecondaryText(true),
+		output: tview.NewTextView(),
+	}
+	p.list.SetBorder(true).SetTitle("   ⚙ Jobs   ")
+	themed(p.list, themeAccent)
+	p.list.SetChangedFunc(func(int, string, string, rune) { p.showOutput() })
+
+	p.output.SetBorder(true).SetTitle("Output")
+	themed(p.output, themePlain)
+	p.output.SetScrollable(true)
+	p.output.SetDynamicColors(true)
+
+	help := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	help.SetBorder(true).SetTitle("Jobs")
+	themed(help, themePlain)
+	help.SetText("◀ " + keymap.Label("up") + "/" + keymap.Label("down") + " select | " +
+		keymap.Help("job_cancel", "cancel", "job_kill", "kill", "job_pause", "pause/resume", "job_resume", "nmap --resume") +
+		" | " + keymap.Label("jobs") + "/" + keymap.Label("back") + " back ▶")
+
+	p.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(help, 3, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(p.list, 0, 1, true).
+			AddItem(p.output, 0, 2, false), 0, 1, true)
+	themed(p.Flex, themePlain)
+
+	mgr.OnChange = func(*Job) {
+		// may be called from the UI goroutine, so never block on the queue
+		go app.QueueUpdateDraw(p.refresh)
+	}
+	go p.tick()
+	return p
+}
+
+// refresh rebuilds the job list, keeping the selection.
+func (p *jobsPage) refresh() {
+	cur := p.list.GetCurrentItem()
+	p.jobs = p.mgr.Jobs()
+	p.list.Clear()
+	for _, j := range p.jobs {
+		st, err := j.State()
+		second := fmt.Sprintf("  %s  %s", stateLabel(st), j.Elapsed().Round(time.Second))
+		if j.Stopping() {
+			second += "  [orange]stopping…[-]"
+		}
+		if pr := j.Progress(); (st == JobRunning || st == JobPaused) && pr.Known {
+			second += "  " + tview.Escape(pr.String())
+		}
+		if err != nil {
+			second += "  " + tview.Escape(err.Error())
+		}
+		p.list.AddItem(fmt.Sprintf("#%d %s", j.ID, j.Name), second, 0, nil)
+	}
+	if cur >= 0 && cur < len(p.jobs) {
+		p.list.SetCurrentItem(cur)
+	}
+	p.showOutput()
+}
+
+func stateLabel(st JobState) string {
+	color := map[JobState]string{
+		JobQueued:    "grey",
+		JobRunning:   "yellow",
+		JobPaused:    "aqua",
+		JobDone:      "green",
+		JobFailed:    "red",
+		JobCancelled: "orange",
+	}[st]
+	return fmt.Sprintf("[%s]%s[-]", color, st)
+}
+
+func (p *jobsPage) selected() *Job {
+	i := p.list.GetCurrentItem()
+	if i < 0 || i >= len(p.jobs) {
+		return nil
+	}
+	return p.jobs[i]
+}
+
+func (p *jobsPage) showOutput() {
+	j := p.selected()
+	if j == nil {
+		p.output.SetText("No jobs yet - press " + keymap.Label("queue") + " on the main screen to queue the current command")
+		return
+	}
+	title := fmt.Sprintf("Output #%d: %s", j.ID, j.Cmd)
+	if pr := j.Progress(); pr.Known {
+		title = fmt.Sprintf("#%d %s", j.ID, pr)
+	}
+	p.output.SetTitle(title)
+	p.output.SetText(tview.Escape(j.Output()))
+	p.output.ScrollToEnd()
+}
+
+// tick refreshes elapsed times and output while jobs are running.
+func (p *jobsPage) tick() {
+	for range time.Tick(time.Second) {
+		for _, j := range p.mgr.Jobs() {
+			if st, _ := j.State(); st == JobRunning {
+				p.app.QueueUpdateDraw(p.refresh)
+				break
+			}
+		}
+	}
+}
+
+// handleAction runs the keymap actions of the jobs page on the selected job.
+func (p *jobsPage) handleAction(action string) {
+	j := p.selected()
+	var err error
+	switch action {
+	case "job_cancel":
+		if j != nil {
+			err = p.mgr.Cancel(j)
+		}
+	case "job_kill":
+		if j != nil {
+			err = p.mgr.Kill(j)
+		}
+	case "job_pause":
+		if j == nil {
+			break
+		}
+		if st, _ := j.State(); st == JobPaused {
+			err = p.mgr.Resume(j)
+		} else {
+			err = p.mgr.Pause(j)
+		}
+	case "job_resume":
+		if j != nil {
+			_, err = p.mgr.ResumeScan(j)
+		}
+	}
+	if err != nil {
+		p.output.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+	}
+}
+
+// queueForm asks for the command line to queue, prefilled with cmd, so the
+// target can be changed before each job (e.g. one job per subnet).
+func queueForm(cmd string, done func(cmdline string, ok bool)) tview.Primitive {
+	form := tview.NewForm()
+	form.AddInputField("Command", cmd, 0, nil, nil)
+	form.AddButton("Queue", func() {
+		done(form.GetFormItem(0).(*tview.InputField).GetText(), true)
+	})
+	form.AddButton("Cancel", func() { done("", false) })
+	form.SetCancelFunc(func() { done("", false) })
+	form.SetBorder(true).SetTitle("Queue job")
+	paintWidget(form, themePlain)
+	return modal(form, 80, 7)
+}
+
+// modal centers p in a box of the given size.
+func modal(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
+
+// errSudoCancelled is reported when the sudo form is cancelled.
+var errSudoCancelled = errors.New("cancelled: no sudo password given")
+
+// errRiskCancelled is reported when risky scripts are not confirmed.
+var errRiskCancelled = errors.New("cancelled: risky NSE scripts not confirmed")
+
+// sudoChoice is how the user wants to run a command that needs root.
+type sudoChoice int
+
+const (
+	sudoCancel sudoChoice = iota
+	sudoRun
+	sudoRunAnyway // without root; nmap falls back or fails
+)
+
+// sudoForm asks for the sudo password for cmd inside the TUI, so NmapX
+// itself never has to run as root.
+func sudoForm(cmd string, priv Privileges, done func(password string, choice sudoChoice)) tview.Primitive {
+	form := tview.NewForm()
+	form.AddTextView("", tview.Escape(privilegeHint(priv))+"\n"+tview.Escape(cmd), 0, 2, true, false)
+	form.AddPasswordField("sudo password", "", 0, '*', nil)
+	password := func() string {
+		return form.GetFormItem(1).(*tview.InputField).GetText()
+	}
+	form.AddButton("Run with sudo", func() { done(password(), sudoRun) })
+	form.AddButton("Run anyway", func() { done("", sudoRunAnyway) })
+	form.AddButton("Cancel", func() { done("", sudoCancel) })
+	form.SetCancelFunc(func() { done("", sudoCancel) })
+	form.SetFocus(1)
+	form.SetBorder(true).SetTitle("Root required")
+	paintWidget(form, themePlain)
+	return modal(form, 80, 11)
+}
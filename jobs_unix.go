@@ -0,0 +1,65 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a process group of its own, so
+// signals reach nmap and not only a wrapper such as sudo.
+func setProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// interruptProcess asks nmap to stop the way Ctrl-C would, so it flushes
+// its output files and they can be used with --resume.
+func interruptProcess(c *exec.Cmd, stdin string) error {
+	return signalGroup(c, stdin, syscall.SIGINT)
+}
+
+func killProcess(c *exec.Cmd, stdin string) error {
+	return signalGroup(c, stdin, syscall.SIGKILL)
+}
+
+func pauseProcess(c *exec.Cmd, stdin string) error {
+	return signalGroup(c, stdin, syscall.SIGSTOP)
+}
+
+func continueProcess(c *exec.Cmd, stdin string) error {
+	return signalGroup(c, stdin, syscall.SIGCONT)
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGINT:  "INT",
+	syscall.SIGKILL: "KILL",
+	syscall.SIGSTOP: "STOP",
+	syscall.SIGCONT: "CONT",
+}
+
+// signalGroup sends sig to the process group of c. Through sudo nmap runs
+// as root and only root may signal it, so the signal goes through
+// "sudo kill", with the password the job was started with (stdin) if any.
+func signalGroup(c *exec.Cmd, stdin string, sig syscall.Signal) error {
+	pgid := c.Process.Pid
+	if len(c.Args) == 0 || c.Args[0] != "sudo" {
+		return syscall.Kill(-pgid, sig)
+	}
+	args := []string{"-n"}
+	if stdin != "" {
+		args = []string{"-S", "-p", ""}
+	}
+	args = append(args, "kill", "-s", signalNames[sig], "--", "-"+strconv.Itoa(pgid))
+	k := execCommand("sudo", args...)
+	if stdin != "" {
+		k.Stdin = strings.NewReader(stdin)
+	}
+	if out, err := k.CombinedOutput(); err != nil {
+		return fmt.Errorf("sudo kill: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
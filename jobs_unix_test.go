@@ -0,0 +1,195 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// procState returns the state letter of pid in /proc (R, S, T, Z …), or
+// "" once the process is gone.
+func procState(t *testing.T, pid int) string {
+	t.Helper()
+	raw, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return ""
+	}
+	// pid (comm) state …
+	f := strings.Fields(string(raw[strings.LastIndexByte(string(raw), ')')+1:]))
+	return f[0]
+}
+
+// waitFor polls cond for up to five seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestJobSignalsReachChildren(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("needs /proc")
+	}
+	// the shell stands in for sudo: the signals must reach the sleep it starts
+	m := newJobManager(JobsConfig{MaxConcurrent: 1})
+	done := make(chan struct{})
+	j, err := m.Add("fake", `sh -c "sleep 60 & echo \$!; wait"`, Then(func(*Job) { close(done) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var child int
+	waitFor(t, "the child pid", func() bool {
+		child, err = strconv.Atoi(strings.TrimSpace(j.Output()))
+		return err == nil
+	})
+
+	if err := m.Pause(j); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the child to stop", func() bool { return procState(t, child) == "T" })
+	if err := m.Resume(j); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the child to continue", func() bool { return procState(t, child) == "S" })
+
+	if err := m.Kill(j); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish after Kill")
+	}
+	if st, _ := j.State(); st != JobCancelled {
+		t.Errorf("state = %s, want cancelled", st)
+	}
+	waitFor(t, "the child to die", func() bool {
+		s := procState(t, child)
+		return s == "" || s == "Z"
+	})
+}
+
+func TestJobDropsPassword(t *testing.T) {
+	m := newJobManager(JobsConfig{MaxConcurrent: 1})
+	done := make(chan struct{})
+	j, err := m.add("stdin", []string{"sh", "-c", "read p; echo got $p"}, "secret\n", []JobOption{Then(func(*Job) { close(done) })})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if out := j.Output(); out != "got secret\n" {
+		t.Errorf("output = %q", out)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stdin != "" {
+		t.Errorf("password kept after the job finished")
+	}
+}
+
+func TestResumeSudoScan(t *testing.T) {
+	chdirTemp(t)
+	if err := os.WriteFile("scan.nmap", []byte("# Nmap\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var ran [][]string
+	saved := execCommand
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		ran = append(ran, append([]string{name}, arg...))
+		return exec.Command("true")
+	}
+	t.Cleanup(func() { execCommand = saved })
+
+	m := newJobManager(JobsConfig{MaxConcurrent: 1})
+	first := &Job{ID: 1, Name: "scan", Args: []string{"sudo", "-S", "-p", "", "nmap", "-sS", "-oN", "scan.nmap", "10.0.0.1"}, state: JobCancelled}
+	j, err := m.ResumeScan(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sudo", "-n", "nmap", "--resume", "scan.nmap"}
+	if !reflect.DeepEqual(j.Args, want) {
+		t.Errorf("resumed args = %q, want %q", j.Args, want)
+	}
+	if len(ran) == 0 || !reflect.DeepEqual(ran[0], want) {
+		t.Errorf("ran %q", ran)
+	}
+}
+
+func TestJobKillAfterIgnoredCancel(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("needs /proc")
+	}
+	m := newJobManager(JobsConfig{MaxConcurrent: 1})
+	done := make(chan struct{})
+	// a child that ignores SIGINT, like an nmap slow to flush its output
+	j, err := m.Add("stubborn", `sh -c "trap '' INT; sleep 60 & echo \$!; wait"`, Then(func(*Job) { close(done) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var child int
+	waitFor(t, "the child pid", func() bool {
+		child, err = strconv.Atoi(strings.TrimSpace(j.Output()))
+		return err == nil
+	})
+
+	if err := m.Cancel(j); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st, _ := j.State(); st != JobRunning || !j.Stopping() {
+		t.Fatalf("after an ignored cancel: state %s, stopping %v", st, j.Stopping())
+	}
+	if err := m.Kill(j); err != nil {
+		t.Fatalf("Kill after Cancel: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish after Kill")
+	}
+	if st, _ := j.State(); st != JobCancelled || j.Stopping() {
+		t.Errorf("state = %s, stopping %v; want cancelled", st, j.Stopping())
+	}
+	waitFor(t, "the child to die", func() bool {
+		s := procState(t, child)
+		return s == "" || s == "Z"
+	})
+	if err := m.Kill(j); err == nil {
+		t.Error("Kill of a finished job gave no error")
+	}
+}
+
+func TestJobStopSignalFails(t *testing.T) {
+	m := newJobManager(JobsConfig{MaxConcurrent: 1})
+	done := make(chan struct{})
+	j, err := m.Add("sleeper", "sleep 60", Then(func(*Job) { close(done) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// e.g. sudo kill with an expired timestamp
+	failing := func(*exec.Cmd, string) error { return errors.New("sudo: a password is required") }
+	if err := m.stop(j, failing); err == nil {
+		t.Fatal("stop hid the signal error")
+	}
+	if st, _ := j.State(); st != JobRunning || j.Stopping() {
+		t.Errorf("after a failed signal: state %s, stopping %v; want running", st, j.Stopping())
+	}
+	if err := m.Kill(j); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if st, _ := j.State(); st != JobCancelled {
+		t.Errorf("state = %s, want cancelled", st)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errNoJobControl = errors.New("pause/resume is not supported on Windows")
+
+func setProcessGroup(c *exec.Cmd) {}
+
+// interruptProcess falls back to killing: Windows has no SIGINT for child processes.
+func interruptProcess(c *exec.Cmd, stdin string) error {
+	return c.Process.Kill()
+}
+
+func killProcess(c *exec.Cmd, stdin string) error {
+	return c.Process.Kill()
+}
+
+func pauseProcess(c *exec.Cmd, stdin string) error {
+	return errNoJobControl
+}
+
+func continueProcess(c *exec.Cmd, stdin string) error {
+	return errNoJobControl
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ---------- key bindings ----------
+
+// KeysConfig changes the key bindings. Bind maps an action name to the
+// keys that replace its defaults: "x", "Space", "Tab", "Esc", "Left",
+// "F2", "Ctrl-X", "Alt-x". Vim adds h/l between the option lists and
+// j/k to move up and down, and moves job kill to 'K'.
+type KeysConfig struct {
+	Vim  bool                `json:"vim"`
+	Bind map[string][]string `json:"bind"`
+}
+
+// keyAction is a command that keys can be bound to, and the contexts
+// (screens) where it works.
+type keyAction struct {
+	name     string
+	contexts []string
+	keys     []string // default keys
+}
+
+// keyActions: el orden es el de la ayuda en README
+var keyActions = []keyAction{
+	// constructor
+	{"prev_list", []string{"main"}, []string{"Left"}},
+	{"next_list", []string{"main"}, []string{"Right"}},
+	{"focus_next", []string{"main"}, []string{"Tab"}},
+	{"explain", []string{"main"}, []string{"x"}},
+	{"explain_results", []string{"main"}, []string{"R"}},
+	{"queue", []string{"main"}, []string{"Q"}},
+	{"two_phase", []string{"main"}, []string{"T"}},
+	{"shard", []string{"main"}, []string{"S"}},
+	{"backend", []string{"main"}, []string{"B"}},
+	{"theme", []string{"main"}, []string{"C"}},
+	{"run_exit", []string{"main"}, []string{"E"}},
+	// pantallas: la misma tecla entra y sale
+	{"jobs", []string{"main", "jobs", "pipelines"}, []string{"J"}},
+	{"pipelines", []string{"main", "pipelines"}, []string{"P"}},
+	{"results_db", []string{"main", "query"}, []string{"D"}},
+	{"import", []string{"main", "import"}, []string{"I"}},
+	{"workspaces", []string{"main", "workspaces"}, []string{"W"}},
+	{"back", []string{"jobs", "pipelines", "query", "import", "workspaces"}, []string{"Esc"}},
+	// en todas las pantallas
+	{"up", []string{"global"}, []string{"Up"}},
+	{"down", []string{"global"}, []string{"Down"}},
+	// lista de scripts NSE
+	{"nse_toggle", []string{"nse"}, []string{"Space"}},
+	{"nse_search", []string{"nse"}, []string{"/"}},
+	{"nse_clear", []string{"nse"}, []string{"c"}},
+	{"nse_args", []string{"nse"}, []string{"a"}},
+	// trabajos
+	{"job_cancel", []string{"jobs"}, []string{"c"}},
+	{"job_kill", []string{"jobs"}, []string{"k"}},
+	{"job_pause", []string{"jobs"}, []string{"p"}},
+	{"job_resume", []string{"jobs"}, []string{"r"}},
+	// base de resultados
+	{"report", []string{"query"}, []string{"r"}},
+	{"focus_query", []string{"query"}, []string{"Tab"}},
+	// importar
+	{"import_mark", []string{"import"}, []string{"Space"}},
+	{"import_mark_all", []string{"import"}, []string{"a"}},
+}
+
+// vimKeys is the Vim preset, on top of the defaults.
+var vimKeys = map[string][]string{
+	"prev_list": {"Left", "h"},
+	"next_list": {"Right", "l"},
+	"up":        {"Up", "k"},
+	"down":      {"Down", "j"},
+	"job_kill":  {"K"},
+}
+
+// keyContexts lists, for each context, the contexts whose keys are active
+// in it: a key may mean only one action in each of these stacks.
+var keyContexts = map[string][]string{
+	"main":       {"main", "global"},
+	"nse":        {"nse", "main", "global"}, // the NSE list is in the builder
+	"jobs":       {"jobs", "global"},
+	"pipelines":  {"pipelines", "global"},
+	"query":      {"query", "global"},
+	"import":     {"import", "global"},
+	"workspaces": {"workspaces", "global"},
+}
+
+// Key is one key of a binding.
+type Key struct {
+	key tcell.Key
+	r   rune // for tcell.KeyRune
+	alt bool
+}
+
+// parseKey reads a key as written in config.json.
+func parseKey(s string) (Key, error) {
+	name := strings.TrimSpace(s)
+	if r := []rune(name); len(r) == 1 {
+		return Key{key: tcell.KeyRune, r: r[0]}, nil
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "":
+		return Key{}, fmt.Errorf("empty key")
+	case lower == "space":
+		return Key{key: tcell.KeyRune, r: ' '}, nil
+	case lower == "escape":
+		return Key{key: tcell.KeyEsc}, nil
+	case strings.HasPrefix(lower, "alt-") || strings.HasPrefix(lower, "alt+"):
+		k, err := parseKey(name[4:])
+		if err != nil || k.key != tcell.KeyRune {
+			return Key{}, fmt.Errorf("key %q: Alt only goes with a character", s)
+		}
+		k.alt = true
+		return k, nil
+	case strings.HasPrefix(lower, "ctrl+"):
+		lower = "ctrl-" + lower[5:]
+	}
+	for k, n := range tcell.KeyNames {
+		if strings.ToLower(n) == lower {
+			return Key{key: k}, nil
+		}
+	}
+	return Key{}, fmt.Errorf("unknown key %q", s)
+}
+
+// String writes the key as the help texts show it.
+func (k Key) String() string {
+	switch {
+	case k.key == tcell.KeyRune && k.r == ' ':
+		return "Space"
+	case k.key == tcell.KeyRune && k.alt:
+		return "Alt-" + string(k.r)
+	case k.key == tcell.KeyRune:
+		return "'" + string(k.r) + "'"
+	}
+	switch k.key {
+	case tcell.KeyLeft:
+		return "←"
+	case tcell.KeyRight:
+		return "→"
+	case tcell.KeyUp:
+		return "↑"
+	case tcell.KeyDown:
+		return "↓"
+	}
+	return tcell.KeyNames[k.key]
+}
+
+// matches reports whether ev is this key.
+func (k Key) matches(ev *tcell.EventKey) bool {
+	if ev.Key() != k.key {
+		return false
+	}
+	if k.key == tcell.KeyRune {
+		return ev.Rune() == k.r && (ev.Modifiers()&tcell.ModAlt != 0) == k.alt
+	}
+	return true
+}
+
+// editing reports whether a text input uses the key itself: characters
+// and the keys that move through or end the text.
+func (k Key) editing() bool {
+	switch k.key {
+	case tcell.KeyRune:
+		return !k.alt
+	case tcell.KeyTab, tcell.KeyBacktab, tcell.KeyEnter, tcell.KeyEsc, tcell.KeyBackspace, tcell.KeyBackspace2,
+		tcell.KeyDelete, tcell.KeyInsert, tcell.KeyLeft, tcell.KeyRight, tcell.KeyUp, tcell.KeyDown,
+		tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn:
+		return true
+	}
+	return false
+}
+
+// Keymap binds actions to keys.
+type Keymap struct {
+	bind map[string][]Key
+}
+
+// keymap is the keymap in use; main replaces it with the one in config.
+var keymap = defaultKeymap()
+
+func defaultKeymap() *Keymap {
+	m, _ := buildKeymap(nil)
+	return m
+}
+
+// loadKeymap builds the keymap of config.json. Unknown actions and keys
+// are reported and left out; if the result binds a key to two actions
+// of the same screen, the conflicts are reported and the defaults are used.
+func loadKeymap(cfg KeysConfig) (*Keymap, []error) {
+	bind := make(map[string][]string)
+	if cfg.Vim {
+		for a, keys := range vimKeys {
+			bind[a] = keys
+		}
+	}
+	for a, keys := range cfg.Bind {
+		bind[a] = keys
+	}
+	m, errs := buildKeymap(bind)
+	if conflicts := m.conflicts(); len(conflicts) > 0 {
+		errs = append(errs, conflicts...)
+		errs = append(errs, fmt.Errorf("keys: conflicting bindings, using the default keys"))
+		return defaultKeymap(), errs
+	}
+	return m, errs
+}
+
+// buildKeymap takes the default keys of each action, or those in bind.
+func buildKeymap(bind map[string][]string) (*Keymap, []error) {
+	m := &Keymap{bind: make(map[string][]Key)}
+	var errs []error
+	known := make(map[string]bool)
+	for _, a := range keyActions {
+		known[a.name] = true
+		names, ok := bind[a.name]
+		if !ok {
+			names = a.keys
+		}
+		for _, n := range names {
+			k, err := parseKey(n)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("keys: %s: %v", a.name, err))
+				continue
+			}
+			m.bind[a.name] = append(m.bind[a.name], k)
+		}
+	}
+	var unknown []string
+	for a := range bind {
+		if !known[a] {
+			unknown = append(unknown, a)
+		}
+	}
+	sort.Strings(unknown)
+	for _, a := range unknown {
+		errs = append(errs, fmt.Errorf("keys: unknown action %q", a))
+	}
+	return m, errs
+}
+
+// conflicts finds keys bound to two actions that are active together.
+func (m *Keymap) conflicts() []error {
+	var errs []error
+	seen := make(map[string]bool)
+	ctxs := make([]string, 0, len(keyContexts))
+	for c := range keyContexts {
+		ctxs = append(ctxs, c)
+	}
+	sort.Strings(ctxs)
+	for _, ctx := range ctxs {
+		owner := make(map[Key]string)
+		for _, a := range m.actions(ctx) {
+			for _, k := range m.bind[a] {
+				prev, ok := owner[k]
+				if !ok {
+					owner[k] = a
+					continue
+				}
+				if prev == a || seen[prev+" "+a] {
+					continue
+				}
+				seen[prev+" "+a] = true
+				errs = append(errs, fmt.Errorf("keys: %s is bound to both %s and %s (%s)", k, prev, a, ctx))
+			}
+		}
+	}
+	return errs
+}
+
+// actions lists the actions active in a context, in keyActions order.
+func (m *Keymap) actions(ctx string) []string {
+	var names []string
+	for _, a := range keyActions {
+		for _, c := range a.contexts {
+			if inList(keyContexts[ctx], c) {
+				names = append(names, a.name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func inList(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Action returns the action of ev in a context, or "" if none. Text
+// inputs keep the keys they use themselves, and buttons the characters,
+// so single-letter actions never fire while typing.
+func (m *Keymap) Action(ctx string, ev *tcell.EventKey, focus tview.Primitive) string {
+	input, button := false, false
+	switch focus.(type) {
+	case *tview.InputField, *tview.TextArea:
+		input = true
+	case *tview.Button:
+		button = true
+	}
+	for _, a := range m.actions(ctx) {
+		for _, k := range m.bind[a] {
+			if !k.matches(ev) {
+				continue
+			}
+			if input && k.editing() || button && k.key == tcell.KeyRune && !k.alt {
+				continue
+			}
+			return a
+		}
+	}
+	return ""
+}
+
+// Label shows the keys of an action for help texts, e.g. 'x' or ←/'h'.
+func (m *Keymap) Label(action string) string {
+	keys := m.bind[action]
+	if len(keys) == 0 {
+		return "(unbound)"
+	}
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+	return strings.Join(names, "/")
+}
+
+// Help joins action/description pairs: "'x' explain | 'Q' queue".
+func (m *Keymap) Help(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, m.Label(pairs[i])+" "+pairs[i+1])
+	}
+	return strings.Join(parts, " | ")
+}
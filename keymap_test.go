@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Key
+		wantErr bool
+	}{
+		{"x", Key{key: tcell.KeyRune, r: 'x'}, false},
+		{"K", Key{key: tcell.KeyRune, r: 'K'}, false},
+		{"/", Key{key: tcell.KeyRune, r: '/'}, false},
+		{"Space", Key{key: tcell.KeyRune, r: ' '}, false},
+		{"Ctrl-X", Key{key: tcell.KeyCtrlX}, false},
+		{"ctrl+x", Key{key: tcell.KeyCtrlX}, false},
+		{"Alt-x", Key{key: tcell.KeyRune, r: 'x', alt: true}, false},
+		{"Alt+X", Key{key: tcell.KeyRune, r: 'X', alt: true}, false},
+		{"F2", Key{key: tcell.KeyF2}, false},
+		{"Escape", Key{key: tcell.KeyEsc}, false},
+		{"Esc", Key{key: tcell.KeyEsc}, false},
+		{"Tab", Key{key: tcell.KeyTab}, false},
+		{"left", Key{key: tcell.KeyLeft}, false},
+		{"", Key{}, true},
+		{"Alt-F2", Key{}, true},
+		{"Hyper-x", Key{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseKey(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseKey(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseKey(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoadKeymap(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       KeysConfig
+		labels    map[string]string // action -> Label
+		conflicts []string          // substrings of the reported errors
+	}{
+		{
+			name:   "defaults",
+			labels: map[string]string{"explain": "'x'", "job_kill": "'k'", "up": "↑", "nse_toggle": "Space", "back": "Esc"},
+		},
+		{
+			name:   "vim",
+			cfg:    KeysConfig{Vim: true},
+			labels: map[string]string{"job_kill": "'K'", "up": "↑/'k'", "down": "↓/'j'", "prev_list": "←/'h'", "next_list": "→/'l'"},
+		},
+		{
+			name:   "rebind",
+			cfg:    KeysConfig{Bind: map[string][]string{"explain": {"Ctrl-X", "F2"}, "queue": {"Alt-q"}}},
+			labels: map[string]string{"explain": "Ctrl-X/F2", "queue": "Alt-q"},
+		},
+		{
+			// 'k' moves up everywhere and kills in jobs
+			name:      "vim without moving kill",
+			cfg:       KeysConfig{Vim: true, Bind: map[string][]string{"job_kill": {"k"}}},
+			labels:    map[string]string{"job_kill": "'k'", "up": "↑"},
+			conflicts: []string{"'k' is bound to both up and job_kill (jobs)", "using the default keys"},
+		},
+		{
+			name:      "same key in one screen",
+			cfg:       KeysConfig{Bind: map[string][]string{"queue": {"x"}}},
+			labels:    map[string]string{"queue": "'Q'"},
+			conflicts: []string{"'x' is bound to both explain and queue (main)"},
+		},
+		{
+			// c cancels jobs and clears the NSE search: different screens
+			name:   "same key in two screens",
+			cfg:    KeysConfig{Bind: map[string][]string{"report": {"c"}}},
+			labels: map[string]string{"report": "'c'", "job_cancel": "'c'"},
+		},
+		{
+			name:      "unknown action and key",
+			cfg:       KeysConfig{Bind: map[string][]string{"fly": {"f"}, "explain": {"Hyper-x", "e"}}},
+			labels:    map[string]string{"explain": "'e'"},
+			conflicts: []string{`unknown key "Hyper-x"`, `unknown action "fly"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, errs := loadKeymap(tt.cfg)
+			var msgs []string
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+			}
+			all := strings.Join(msgs, "\n")
+			for _, c := range tt.conflicts {
+				if !strings.Contains(all, c) {
+					t.Errorf("errors %q lack %q", msgs, c)
+				}
+			}
+			if len(tt.conflicts) == 0 && len(errs) > 0 {
+				t.Errorf("unexpected errors %q", msgs)
+			}
+			for action, want := range tt.labels {
+				if got := m.Label(action); got != want {
+					t.Errorf("Label(%s) = %s, want %s", action, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultKeymapHasNoConflicts(t *testing.T) {
+	if errs := defaultKeymap().conflicts(); len(errs) > 0 {
+		t.Errorf("default keys conflict: %v", errs)
+	}
+	m, _ := loadKeymap(KeysConfig{Vim: true})
+	if errs := m.conflicts(); len(errs) > 0 {
+		t.Errorf("vim keys conflict: %v", errs)
+	}
+}
+
+func TestKeymapAction(t *testing.T) {
+	m, _ := loadKeymap(KeysConfig{Vim: true, Bind: map[string][]string{"explain": {"x", "Ctrl-X"}}})
+	char := func(r rune) *tcell.EventKey { return tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone) }
+	tests := []struct {
+		ctx   string
+		ev    *tcell.EventKey
+		focus tview.Primitive
+		want  string
+	}{
+		{"main", char('x'), tview.NewList(), "explain"},
+		{"main", char('x'), tview.NewInputField(), ""}, // typing
+		{"main", tcell.NewEventKey(tcell.KeyCtrlX, 0, tcell.ModCtrl), tview.NewInputField(), "explain"},
+		{"main", char('x'), tview.NewButton("ok"), ""},
+		{"jobs", char('K'), tview.NewTable(), "job_kill"},
+		{"jobs", char('k'), tview.NewTable(), "up"},
+		{"jobs", char('x'), tview.NewTable(), ""}, // explain is not in jobs
+		{"nse", char('j'), tview.NewList(), "down"},
+		{"query", tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone), tview.NewTable(), "back"},
+	}
+	for _, tt := range tests {
+		if got := m.Action(tt.ctx, tt.ev, tt.focus); got != tt.want {
+			t.Errorf("Action(%s, %s, %T) = %q, want %q", tt.ctx, tt.ev.Name(), tt.focus, got, tt.want)
+		}
+	}
+	if got := m.Help("explain", "explain", "queue", "queue"); got != "'x'/Ctrl-X explain | 'Q' queue" {
+		t.Errorf("Help = %q", got)
+	}
+}
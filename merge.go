@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// ---------- merging nmap runs ----------
+
+// mergeNmapRuns joins several scans into one run: every host of every
+// scan, with the ports of the same host combined. When scans disagree
+// the newest one wins, host by host (its starttime, else its scan's
+// start); script output only an older scan has is kept. args becomes the
+// args attribute of the result.
+func mergeNmapRuns(runs []*NmapRun, args string) *NmapRun {
+	merged := &NmapRun{Scanner: "nmap", Args: args, XMLOutputVersion: "1.05"}
+	type dated struct {
+		host Host
+		when int64
+	}
+	var hosts []dated
+	var newest *NmapRun
+	info := make(map[string]int) // scaninfo by type/protocol
+	var end int64
+	// oldest scan first: its scaninfo is replaced by newer ones
+	runs = append([]*NmapRun(nil), runs...)
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[j] != nil && (runs[i] == nil || runs[i].Start < runs[j].Start)
+	})
+	for _, run := range runs {
+		if run == nil {
+			continue
+		}
+		if run.Start != 0 && (merged.Start == 0 || run.Start < merged.Start) {
+			merged.Start = run.Start
+		}
+		if newest == nil || run.Start >= newest.Start {
+			newest = run
+		}
+		if run.RunStats != nil && run.RunStats.Finished.Time > end {
+			end = run.RunStats.Finished.Time
+		}
+		for _, si := range run.ScanInfo {
+			key := si.Type + "/" + si.Protocol
+			if i, ok := info[key]; ok {
+				merged.ScanInfo[i] = si
+				continue
+			}
+			info[key] = len(merged.ScanInfo)
+			merged.ScanInfo = append(merged.ScanInfo, si)
+		}
+		for _, h := range run.Hosts {
+			when := h.StartTime
+			if when == 0 {
+				when = run.Start
+			}
+			hosts = append(hosts, dated{h, when})
+		}
+	}
+	if newest != nil {
+		merged.Version = newest.Version
+	}
+	// oldest first, so that dedupeHosts lets the newest win
+	sort.SliceStable(hosts, func(i, j int) bool { return hosts[i].when < hosts[j].when })
+	for _, h := range hosts {
+		merged.Hosts = append(merged.Hosts, h.host)
+	}
+	dedupeHosts(merged)
+	sort.SliceStable(merged.Hosts, func(a, b int) bool { return hostLess(merged.Hosts[a], merged.Hosts[b]) })
+
+	// runstats describe the merged document, as tools read host counts there
+	stats := &RunStats{}
+	for _, h := range merged.Hosts {
+		if h.Status.State == "down" {
+			stats.Hosts.Down++
+		} else {
+			stats.Hosts.Up++
+		}
+	}
+	stats.Hosts.Total = len(merged.Hosts)
+	if end == 0 {
+		end = time.Now().Unix()
+	}
+	stats.Finished.Time = end
+	stats.Finished.TimeStr = time.Unix(end, 0).Format("Mon Jan _2 15:04:05 2006")
+	if merged.Start != 0 && end >= merged.Start {
+		stats.Finished.Elapsed = float64(end - merged.Start)
+	}
+	stats.Finished.Summary = fmt.Sprintf("Merged %d scans: %d IP addresses (%d hosts up)", len(runs), stats.Hosts.Total, stats.Hosts.Up)
+	stats.Finished.Exit = "success"
+	merged.RunStats = stats
+	return merged
+}
+
+// mergeNmapFiles parses scan results (any format parseNmapFile reads) and
+// merges them with mergeNmapRuns.
+func mergeNmapFiles(paths []string, args string) (*NmapRun, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files to merge")
+	}
+	runs := make([]*NmapRun, 0, len(paths))
+	for _, p := range paths {
+		run, _, err := parseNmapFile(p)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return mergeNmapRuns(runs, args), nil
+}
+
+// hostLess orders hosts by address, IPv4 numerically.
+func hostLess(a, b Host) bool {
+	ia, okA := ipv4Int(net.ParseIP(a.Addr()))
+	ib, okB := ipv4Int(net.ParseIP(b.Addr()))
+	if okA && okB {
+		return ia < ib
+	}
+	if okA != okB {
+		return okA
+	}
+	return a.Addr() < b.Addr()
+}
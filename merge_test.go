@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// childOrder lists, for each host of an nmap XML document, the names of
+// its children and those of its <ports>, in document order.
+func childOrder(t *testing.T, data []byte) (hosts, ports [][]string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	var stack []string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			name := tok.Name.Local
+			switch {
+			case name == "host":
+				hosts = append(hosts, nil)
+				ports = append(ports, nil)
+			case len(stack) > 0 && stack[len(stack)-1] == "host":
+				hosts[len(hosts)-1] = append(hosts[len(hosts)-1], name)
+			case len(stack) > 0 && stack[len(stack)-1] == "ports":
+				ports[len(ports)-1] = append(ports[len(ports)-1], name)
+			}
+			stack = append(stack, name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return hosts, ports
+}
+
+func TestMergeNmapFilesRoundTrip(t *testing.T) {
+	merged, err := mergeNmapFiles([]string{"testdata/scan-scripts.xml", "testdata/scan-os.xml"}, "nmapx merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "merged.xml")
+	if err := writeNmapXML(out, merged); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nmap.dtd: times last, extraports before port
+	hosts, ports := childOrder(t, data)
+	wantHosts := [][]string{
+		{"status", "address", "address", "hostnames", "ports", "os", "uptime", "distance",
+			"tcpsequence", "ipidsequence", "tcptssequence", "hostscript", "trace", "times"},
+		{"status", "address", "address", "hostnames", "ports", "os", "distance", "times"},
+	}
+	wantPorts := [][]string{
+		{"extraports", "port", "port", "port"},
+		{"extraports", "port"},
+	}
+	if !reflect.DeepEqual(hosts, wantHosts) {
+		t.Errorf("host children:\n got %q\nwant %q", hosts, wantHosts)
+	}
+	if !reflect.DeepEqual(ports, wantPorts) {
+		t.Errorf("ports children:\n got %q\nwant %q", ports, wantPorts)
+	}
+
+	run, err := parseNmapXML(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Hosts) != 2 {
+		t.Fatalf("%d hosts, want 2", len(run.Hosts))
+	}
+	dc := run.Hosts[0]
+	if len(dc.ExtraPorts) != 1 || dc.ExtraPorts[0].State != "closed" || dc.ExtraPorts[0].Count != 997 || len(dc.ExtraPorts[0].Reasons) != 1 {
+		t.Errorf("extraports = %+v", dc.ExtraPorts)
+	}
+	if len(dc.Ports) != 3 || dc.Ports[0].Service.Product != "OpenSSH" || len(dc.Ports[0].Scripts) != 1 {
+		t.Errorf("ports = %+v", dc.Ports)
+	}
+	if len(dc.HostScripts) != 2 {
+		t.Errorf("host scripts = %+v", dc.HostScripts)
+	}
+
+	// a second pass writes the same document
+	again := filepath.Join(t.TempDir(), "again.xml")
+	if err := writeNmapXML(again, run); err != nil {
+		t.Fatal(err)
+	}
+	data2, err := os.ReadFile(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data2) != string(data) {
+		t.Errorf("second round trip changed the document:\n%s", data2)
+	}
+}
+
+func TestHostWithoutPorts(t *testing.T) {
+	h := Host{Status: Status{State: "down"}, Addresses: []Address{{"10.0.0.9", "ipv4"}}}
+	data, err := xml.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); strings.Contains(s, "<ports") || strings.Contains(s, "<hostscript") {
+		t.Errorf("empty elements in %s", s)
+	}
+}
@@ -1,3 +1,8 @@
+//go:build ignore
+
+// Earlier single-file version of NmapX, kept for reference. Excluded from the
+// build because it redeclares everything in nmapX.go.
+
 // Package main implements a six-screen interactive TUI for building and executing an nmap command.
 // Navigate with ←/→ arrows; selections persist and update the command and selected descriptions.
 // Press 'x' to execute the assembled nmap command and view output in the Details pane.
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,31 +13,6 @@ import (
 	"github.com/rivo/tview"
 )
 
-// OpenAI API endpoint
-const apiURL = "https://api.openai.com/v1/chat/completions"
-
-// ---------- OpenAI payload types ----------
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type RequestBody struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-}
-
-type Choice struct {
-	Message Message `json:"message"`
-}
-
-type ResponseBody struct {
-	Choices []Choice `json:"choices"`
-}
-
-//-------------------------------------------
-
 type CustomCmd struct {
 	Name string
 	Cmd  string
@@ -67,13 +41,38 @@ func loadCustomCommands(path string) ([]CustomCmd, error) {
 }
 
 func main() {
+	if runSubcommand() {
+		return
+	}
+
 	var runAfter bool   // flag to execute nmapx after TUI
 	var finalCmd string // command to run after exit
 
+	fs := flag.NewFlagSet("nmapx", flag.ExitOnError)
+	wsName := fs.String("workspace", "", "named workspace to use, created if missing")
+	fs.Parse(os.Args[1:])
+
 	// Get target host from command line arguments
 	target := "localhost" // default target
-	if len(os.Args) > 1 {
-		target = os.Args[1]
+	if fs.NArg() > 0 {
+		target = strings.Join(fs.Args(), " ")
+	}
+
+	var workspace *Workspace
+	if *wsName != "" {
+		ws, err := openWorkspace(*wsName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "nmapx:", err)
+			os.Exit(1)
+		}
+		workspace = ws
+		if fs.NArg() > 0 {
+			if err := ws.AddTarget(target); err != nil {
+				fmt.Fprintln(os.Stderr, "workspace:", err)
+			}
+		} else if t := ws.Target(); t != "" {
+			target = t
+		}
 	}
 
 	// Cargar comandos personalizados
@@ -82,24 +81,87 @@ func main() {
 		customCmds = []CustomCmd{{Name: "No custom commands found - add it to /opt/4rji/bin/nmap-commands", Cmd: ""}}
 	}
 
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config:", err)
+	}
+	pipelines, errs := validPipelines(cfg.Pipelines)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "config:", err)
+	}
+	themes, errs := loadThemes(cfg.Themes)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "config:", err)
+	}
+	km, errs := loadKeymap(cfg.Keys)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "config:", err)
+	}
+	keymap = km
+	redactCfg, err := loadRedactConfig(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "redact:", err)
+	}
+	// ajustes que cada workspace puede sustituir
+	wsRedact := func(ws *Workspace) RedactConfig {
+		if ws != nil && ws.Meta.Redact != nil {
+			return *ws.Meta.Redact
+		}
+		return redactCfg
+	}
+	usage := newUsageTracker(cfg.Explain, filepath.Join(configDir(), "usage.json"))
+	explainer := newExplainer(cfg.Explain, newRedactor(wsRedact(workspace)), usage)
+	jobMgr := newJobManager(cfg.Jobs)
+	outputs := newOutputManager(workspaceOutput(cfg.Output, workspace))
+	results := newResultsDB(workspace)
+	nmapInfo := probeNmap(cfg.Nmap)
+	priv := detectPrivileges(nmapInfo.Path)
+
 	app := tview.NewApplication()
+	if screen, err := tcell.NewScreen(); err == nil {
+		if noColor() {
+			app.SetScreen(monoScreen{screen})
+		} else {
+			app.SetScreen(screen)
+		}
+		setOSC52Screen(screen) // copy over SSH via the terminal itself
+	}
 
-	// Configurar estilos globales
-	tview.Styles.PrimitiveBackgroundColor = tcell.ColorDarkBlue
-	tview.Styles.ContrastBackgroundColor = tcell.ColorDarkBlue
-	tview.Styles.MoreContrastBackgroundColor = tcell.ColorDarkBlue
-	tview.Styles.BorderColor = tcell.ColorGreen
-	tview.Styles.TitleColor = tcell.ColorGreen
-	tview.Styles.GraphicsColor = tcell.ColorLightCyan
-	tview.Styles.PrimaryTextColor = tcell.ColorWhite
-	tview.Styles.SecondaryTextColor = tcell.ColorLightGrey
+	// Configurar estilos globales: tema de config.json, sin colores con NO_COLOR
+	theme := builtinThemes[0]
+	if i := themeIndex(themes, cfg.Theme); i >= 0 {
+		theme = themes[i]
+	} else {
+		fmt.Fprintf(os.Stderr, "config: no theme named %q\n", cfg.Theme)
+	}
+	if noColor() {
+		theme = monoTheme
+	}
+	applyTheme(theme)
 
 	// ========== Helper banner ===========
 	helper := tview.NewTextView()
 	helper.SetTextAlign(tview.AlignCenter)
 	helper.SetBorder(true).SetTitle("Navigation")
-	helper.SetBackgroundColor(tcell.ColorDarkBlue)
-	helper.SetText("◀ ←/→ navigate | 'x' explain | 'E' run & exit ▶")
+	themed(helper, themePlain)
+	helper.SetDynamicColors(true)
+	backend := backends[0] // escáner al que se traducen las opciones
+	setHelper := func() {
+		ws := "no workspace"
+		if workspace != nil {
+			ws = "ws " + workspace.Name
+		}
+		if backend.Name() != "nmap" {
+			ws += " | backend " + backend.Name()
+		}
+		helper.SetText("◀ " + keymap.Label("prev_list") + "/" + keymap.Label("next_list") + " navigate | " +
+			keymap.Help("explain", "explain", "explain_results", "explain results", "queue", "queue", "two_phase", "two-phase",
+				"jobs", "jobs", "pipelines", "pipelines", "shard", "shard", "results_db", "results DB", "import", "import",
+				"workspaces", "workspaces", "backend", "backend", "theme", "colours", "run_exit", "run & exit") +
+			" ▶ " + ws + " | " + nmapInfo.String() + " | " + priv.String() + " | " + usage.Status())
+	}
+	setHelper()
+	usage.OnChange = func() { app.QueueUpdateDraw(setHelper) }
 
 	// ========== Option sets for 6 screens ==========
 	hostOpts := []struct{ label, flag, desc string }{
@@ -132,11 +194,10 @@ func main() {
 		{"Decoys", "-D RND:10", "Random decoy IPs"},
 		{"Spoof IP", "-S 1.2.3.4", "Fake source IP"},
 	}
-	scriptOpts := []struct{ label, flag, desc string }{
-		{"firewalk", "--script=firewalk", "Trace firewall rules"},
-		{"ssl‑ciphers", "--script=ssl-enum-ciphers", "Enumerate SSL ciphers"},
-		{"dns‑brute", "--script=dns-brute", "Brute‑force subdomains"},
-	}
+	// NSE: todos los scripts de nmap, cargados en segundo plano
+	nse := newScriptBrowser(app, func() {})
+	nse.forbid = workspace.Forbidden()
+	nse.unsupported = nmapInfo.ScriptUnsupported
 
 	// selection slices
 	hostSel := make([]bool, len(hostOpts))
@@ -144,29 +205,32 @@ func main() {
 	portSel := make([]bool, len(portOpts))
 	timeSel := make([]bool, len(timeOpts))
 	evasionSel := make([]bool, len(evasionOpts))
-	scriptSel := make([]bool, len(scriptOpts))
 
 	// -------- Views --------
 	cmdView := tview.NewTextView()
 	cmdView.SetDynamicColors(true)
 	cmdView.SetBorder(true)
 	cmdView.SetTitle("Command")
-	cmdView.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(cmdView, themePlain)
 
 	selDesc := tview.NewTextView()
 	selDesc.SetDynamicColors(true)
 	selDesc.SetBorder(true)
 	selDesc.SetTitle("Selected")
-	selDesc.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(selDesc, themePlain)
 
 	detail := tview.NewTextView()
 	detail.SetDynamicColors(true)
 	detail.SetBorder(true)
 	detail.SetTitle("Explanation")
-	detail.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(detail, themePlain)
 
 	// Variable para el comando limpio
 	var lastCmdStr string
+	lastCmdName := "Builder"   // nombre del trabajo al encolar
+	lastCmdBuilt := true       // comando del constructor (no personalizado)
+	var lastPipeline *Pipeline // pipeline seleccionado en customList
+	var dropped []string       // opciones sin equivalente en backend
 
 	// Botón Copy
 	copyBtn := tview.NewButton("Copy").SetSelectedFunc(func() {
@@ -184,18 +248,12 @@ func main() {
 		}()
 	})
 	copyBtn.SetBorder(true)
-	copyBtn.SetBackgroundColor(tcell.ColorDarkBlue)
-	copyBtn.SetBorderColor(tcell.ColorGreen)
-	copyBtn.SetFocusFunc(func() {
-		copyBtn.SetBorderColor(tcell.ColorYellow)
-	})
-	copyBtn.SetBlurFunc(func() {
-		copyBtn.SetBorderColor(tcell.ColorGreen)
-	})
+	themed(copyBtn, themeFocus)
 
 	// -------- Update function --------
-	update := func() {
-		parts := []string{"nmap"}
+	// builderCmd is the command made from the selected options
+	builderCmd := func() string {
+		var parts []string
 		add := func(opts []struct{ label, flag, desc string }, sel []bool) {
 			for i, s := range sel {
 				if s {
@@ -208,10 +266,19 @@ func main() {
 		add(portOpts, portSel)
 		add(timeOpts, timeSel)
 		add(evasionOpts, evasionSel)
-		add(scriptOpts, scriptSel)
-		parts = append(parts, target) // Add target host to the command
-		cmdStr := strings.Join(parts, " ")
+		if arg := nse.Arg(); arg != "" {
+			parts = append(parts, arg)
+		}
+		cmd, lost := backend.Command(parts, target)
+		dropped = lost
+		return cmd
+	}
+	update := func() {
+		cmdStr := builderCmd()
 		lastCmdStr = cmdStr // Guardar el comando limpio para copiar
+		lastCmdName = "Builder"
+		lastCmdBuilt = true
+		lastPipeline = nil
 		// Simular grosor: repetir y rodear con ▓
 		decorated := fmt.Sprintf("▓ %s ▓\n▓ %s ▓", cmdStr, cmdStr)
 		cmdView.SetText(decorated)
@@ -229,31 +296,54 @@ func main() {
 		dump(portOpts, portSel)
 		dump(timeOpts, timeSel)
 		dump(evasionOpts, evasionSel)
-		dump(scriptOpts, scriptSel)
+		if len(nse.selected) > 0 {
+			fmt.Fprintf(&b, "NSE (%s)\n", strings.Join(nse.selected, ","))
+		}
+		if args := nse.scriptArgs(); len(args) > 0 {
+			fmt.Fprintf(&b, "Script args (%s)\n", formatScriptArgs(args))
+		}
+		if len(dropped) > 0 {
+			fmt.Fprintf(&b, "[yellow]No equivalent in %s: %s[-]\n", backend.Name(), tview.Escape(strings.Join(dropped, " ")))
+		}
+		if args, err := splitArgs(cmdStr); err == nil {
+			if risky := riskyOf(commandScriptCategories(args, nse.scripts)); len(risky) > 0 {
+				fmt.Fprintf(&b, "[red]⚠ NSE %s: %s asks for confirmation[-]\n", strings.Join(risky, ", "), keymap.Label("run_exit"))
+			}
+		}
 		selDesc.SetText(b.String())
 	}
 	update()
+	nse.onChange = update
 
 	// -------- List builder --------
 	makeList := func(title string, opts []struct{ label, flag, desc string }, sel []bool) *tview.List {
 		l := tview.NewList().ShowSecondaryText(true)
 		l.SetBorder(true).SetTitle(title)
-		l.SetBorderColor(tcell.ColorGreen)
-		l.SetFocusFunc(func() {
-			l.SetBorderColor(tcell.ColorYellow)
-		})
-		l.SetBlurFunc(func() {
-			l.SetBorderColor(tcell.ColorGreen)
-		})
+		themed(l, themeFocus)
 		for i, o := range opts {
-			idx := i
-			l.AddItem(fmt.Sprintf("(%d) %s", i+1, o.label), o.desc, rune('1'+i), func() {
+			idx, o := i, o
+			label := o.label
+			if flagNeedsRoot(o.flag) {
+				label += rootLabel(priv)
+			}
+			// opciones que este nmap no soporta: avisar y no seleccionar
+			unsupported := nmapInfo.Unsupported(o.flag)
+			desc := o.desc
+			if unsupported != "" {
+				label += " [grey](n/a)[-]"
+				desc = unsupported
+			}
+			l.AddItem(fmt.Sprintf("(%d) %s", idx+1, label), desc, rune('1'+i), func() {
+				if unsupported != "" && !sel[idx] {
+					detail.SetText("[yellow]" + tview.Escape(unsupported) + "[-]")
+					return
+				}
 				sel[idx] = !sel[idx]
-				mark := o.label
+				mark := label
 				if sel[idx] {
-					mark = "[*] " + o.label
+					mark = "[*] " + label
 				}
-				l.SetItemText(idx, fmt.Sprintf("(%d) %s", i+1, mark), o.desc)
+				l.SetItemText(idx, fmt.Sprintf("(%d) %s", idx+1, mark), desc)
 				update()
 			})
 		}
@@ -266,27 +356,56 @@ func main() {
 	portList := makeList("   📦 Ports   ", portOpts, portSel)
 	timeList := makeList("   ⏱ Timing   ", timeOpts, timeSel)
 	evasList := makeList("   🛡 Evasion   ", evasionOpts, evasionSel)
-	nseList := makeList("   💻 NSE   ", scriptOpts, scriptSel)
+	nseList := nse.list
 
 	// Lista de comandos personalizados
 	customList := tview.NewList().ShowSecondaryText(true)
 	customList.SetBorder(true).SetTitle("Custom Commands /opt/4rji/bin/nmap-commands")
-	customList.SetBorderColor(tcell.ColorGreen)
-	customList.SetFocusFunc(func() {
-		customList.SetBorderColor(tcell.ColorYellow)
-	})
-	customList.SetBlurFunc(func() {
-		customList.SetBorderColor(tcell.ColorGreen)
-	})
-	for _, c := range customCmds {
-		c := c // captura para el closure
-		customList.AddItem(c.Name, c.Cmd, 0, func() {
-			customCmd := strings.ReplaceAll(c.Cmd, "{target}", target)
-			lastCmdStr = customCmd
-			decorated := fmt.Sprintf("▓ %s ▓\n▓ %s ▓", customCmd, customCmd)
-			cmdView.SetText(decorated)
-		})
+	themed(customList, themeFocus)
+	loadCustomList := func() {
+		customList.Clear()
+		cmds := customCmds
+		if workspace != nil {
+			cmds = workspace.CustomCommands(customCmds)
+		}
+		for _, c := range cmds {
+			c := c // captura para el closure
+			label := c.Name
+			if args, err := splitArgs(c.Cmd); err == nil {
+				label = riskMark(commandScriptCategories(args, nse.scripts), workspace.Forbidden()) + label
+			}
+			customList.AddItem(label, c.Cmd, 0, func() {
+				customCmd := strings.ReplaceAll(c.Cmd, "{target}", target)
+				lastCmdStr = customCmd
+				lastCmdName = c.Name
+				lastCmdBuilt = false
+				lastPipeline = nil
+				decorated := fmt.Sprintf("▓ %s ▓\n▓ %s ▓", customCmd, customCmd)
+				cmdView.SetText(decorated)
+			})
+		}
+		for _, p := range pipelines {
+			p := p
+			customList.AddItem("⛓ "+p.Name, fmt.Sprintf("pipeline, %d steps", len(p.Steps)), 0, func() {
+				lastPipeline = &p
+				lastCmdStr = strings.Join(strings.Fields("nmap "+p.Steps[0].Args+" "+target), " ")
+				lastCmdName = p.Name
+				lastCmdBuilt = true
+				cmdView.SetText("▓ Pipeline " + tview.Escape(p.Name) + " ▓ press " + keymap.Label("queue") + " to run\n" + tview.Escape(p.Describe()))
+			})
+		}
 	}
+	loadCustomList()
+	go func() {
+		scripts, note := loadNSECatalog(cfg.NSE, nmapInfo.Path)
+		if scripts == nil {
+			note += " - showing a few common scripts"
+		}
+		app.QueueUpdateDraw(func() {
+			nse.setScripts(scripts, note)
+			loadCustomList() // marcar comandos con scripts peligrosos
+		})
+	}()
 
 	// pages
 	pages := tview.NewPages().
@@ -295,15 +414,555 @@ func main() {
 		AddPage("port", portList, true, false).
 		AddPage("time", timeList, true, false).
 		AddPage("evas", evasList, true, false).
-		AddPage("nse", nseList, true, false)
+		AddPage("nse", nse, true, false)
+	themed(pages, themePlain)
 
 	order := []string{"host", "scan", "port", "time", "evas", "nse", "custom"}
 	tabOrder := []tview.Primitive{hostList, scanList, portList, timeList, evasList, nseList, customList, copyBtn}
 
+	// pantallas: principal, trabajos y formularios modales encima
+	screens := tview.NewPages()
+	themed(screens, themePlain)
+	jobs := newJobsPage(app, jobMgr)
+	var mainFocus tview.Primitive = hostList
+	showJobs := func() {
+		mainFocus = app.GetFocus()
+		jobs.refresh()
+		screens.SwitchToPage("jobs")
+		app.SetFocus(jobs.list)
+	}
+	showMain := func() {
+		screens.SwitchToPage("main")
+		app.SetFocus(mainFocus)
+	}
+	query := newQueryPage(app, func() *ResultsDB { return results }, showMain)
+	showQuery := func() {
+		mainFocus = app.GetFocus()
+		screens.SwitchToPage("query")
+		app.SetFocus(query.input)
+	}
+	// reportOfQuery writes a report of the query page's current query
+	reportOfQuery := func() {
+		title := "Nmap scan report"
+		if workspace != nil {
+			title += " - " + workspace.Name
+		}
+		path := filepath.Join(outputs.Dir(), "report-"+time.Now().Format("20060102-150405"))
+		screens.AddPage("report", reportForm(title, path, func(title, format, path string, ok bool) {
+			screens.RemovePage("report")
+			app.SetFocus(query.table)
+			if !ok {
+				return
+			}
+			q, err := parseQuery(query.input.GetText(), time.Now())
+			var hosts []HostRecord
+			if err == nil {
+				hosts, err = results.Hosts(q)
+			}
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(path), 0o755)
+			}
+			if err == nil {
+				err = saveReport(path, format, newReport(title, hosts, q))
+			}
+			if err != nil {
+				query.status.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+				return
+			}
+			query.status.SetText("Report saved to " + tview.Escape(path))
+		}), true, true)
+	}
+	var importer *importPage
+	importer = newImportPage(func(paths []string) {
+		db := results
+		go func() {
+			res, err := importFiles(db, paths)
+			app.QueueUpdateDraw(func() { importer.done(res, err) })
+		}()
+	})
+	// chooseBackend cambia el escáner al que se traduce el constructor
+	chooseBackend := func() {
+		mainFocus = app.GetFocus()
+		screens.AddPage("backend", backendForm(backend, func(b Backend, ok bool) {
+			screens.RemovePage("backend")
+			app.SetFocus(mainFocus)
+			if !ok {
+				return
+			}
+			backend = b
+			update()
+			setHelper()
+			detail.SetText("Backend " + b.Name())
+		}), true, true)
+	}
+	showImport := func() {
+		mainFocus = app.GetFocus()
+		dir := "."
+		if _, err := os.Stat(outputs.Dir()); err == nil {
+			dir = outputs.Dir()
+		}
+		importer.show(dir)
+		screens.SwitchToPage("import")
+		app.SetFocus(importer.list)
+	}
+	// los resultados XML de cada job terminado van a la base de datos
+	jobMgr.OnFinish = func(j *Job) {
+		path := resultsPath(j.Cmd)
+		if st, _ := j.State(); st != JobDone || path == "" {
+			return
+		}
+		go app.QueueUpdate(func() {
+			db := results
+			go func() {
+				if _, err := db.storeFile(path); err != nil {
+					app.QueueUpdateDraw(func() { detail.SetText(tview.Escape(err.Error())) })
+				}
+			}()
+		})
+	}
+	queued := func(_ *Job, err error) {
+		if err != nil {
+			detail.SetText(tview.Escape(err.Error()))
+			return
+		}
+		detail.SetText("Queued - press " + keymap.Label("jobs") + " to see jobs")
+	}
+	// newPrompt names the page of a sudo or confirmation prompt and keeps
+	// the focus to give back when it closes. Pipelines and shards queue
+	// jobs from their goroutines, so prompts can pile up: each one gets a
+	// page of its own and they stack instead of replacing each other
+	nPrompts := 0
+	newPrompt := func(kind string) (string, tview.Primitive) {
+		nPrompts++
+		return fmt.Sprintf("%s-%d", kind, nPrompts), app.GetFocus()
+	}
+	// submitJob queues cmdline, getting root first if its options need it
+	// done gets the queued job, or why there is none
+	submitJob := func(name, cmdline string, done func(*Job, error), opts ...JobOption) {
+		args, err := splitArgs(cmdline)
+		if err != nil {
+			done(nil, err)
+			return
+		}
+		switch {
+		case !needsRoot(args) || priv.Root:
+			done(jobMgr.Add(name, cmdline, opts...))
+		case priv.NmapCaps && runsNmap(args):
+			done(jobMgr.Add(name, joinArgs(withPrivileged(args)), opts...))
+		case sudoCached():
+			done(jobMgr.AddSudo(name, cmdline, "", opts...))
+		default:
+			page, back := newPrompt("sudo")
+			screens.AddPage(page, sudoForm(cmdline, priv, func(password string, choice sudoChoice) {
+				screens.RemovePage(page)
+				app.SetFocus(back)
+				switch choice {
+				case sudoRun:
+					done(jobMgr.AddSudo(name, cmdline, password, opts...))
+				case sudoRunAnyway:
+					done(jobMgr.Add(name, cmdline, opts...))
+				default:
+					done(nil, errSudoCancelled)
+				}
+			}), true, true)
+		}
+	}
+	// confirmRisk asks to type the risky NSE categories the commands can
+	// run, leaving out those in ack, confirmed before for the same run.
+	// proceed gets every category confirmed so far; cancel runs on a no
+	confirmRisk := func(cmdlines, ack []string, proceed func(ack []string), cancel func()) {
+		missing := unconfirmed(riskyCommands(cmdlines, nse.scripts), ack)
+		if len(missing) == 0 {
+			proceed(ack)
+			return
+		}
+		page, back := newPrompt("confirm")
+		screens.AddPage(page, riskConfirmForm(strings.Join(cmdlines, "\n"), missing, func(ok bool) {
+			screens.RemovePage(page)
+			app.SetFocus(back)
+			if ok {
+				proceed(append(append([]string(nil), ack...), missing...))
+			} else {
+				cancel()
+			}
+		}), true, true)
+	}
+	// launch checks the scanner, the risky scripts not in ack and the scope,
+	// gives the scan its folder and queues it; done gets the job or why
+	// there is none. results makes sure the scan writes a results file a
+	// later step can read
+	launch := func(name, cmdline string, built, results bool, ack []string, done func(*Job, error), opts ...JobOption) {
+		if args, err := splitArgs(cmdline); err == nil {
+			if err := checkScanner(nmapInfo, args); err != nil {
+				done(nil, err)
+				return
+			}
+		}
+		confirmRisk([]string{cmdline}, ack, func([]string) {
+			cmdline, err := prepareScan(workspace, outputs, nse.scripts, name, cmdline, target, built, results)
+			if err != nil {
+				done(nil, err)
+				return
+			}
+			submitJob(name, nmapInfo.Command(cmdline), done, opts...)
+		}, func() { done(nil, errRiskCancelled) })
+	}
+	pipeRuns := newPipelinesPage()
+	go pipeRuns.tick(app)
+	nextRun := 1
+	// runLauncher queues the jobs of pipelines and sharded scans, whose
+	// risky categories ack were confirmed when the run started, making
+	// sure each writes the results the run reads next. It is called from
+	// their goroutines: queue on the UI and wait, the sudo form may be shown
+	runLauncher := func(ack []string) func(name, cmdline string, then JobOption) error {
+		return func(name, cmdline string, then JobOption) error {
+			res := make(chan error, 1)
+			app.QueueUpdateDraw(func() {
+				launch(name, cmdline, true, true, ack, func(_ *Job, err error) { res <- err }, then)
+			})
+			return <-res
+		}
+	}
+	// queuePipeline asks for a target and runs p, step by step, as jobs
+	queuePipeline := func(p Pipeline) {
+		mainFocus = app.GetFocus()
+		screens.AddPage("pipeline", pipelineForm(p, target, func(t string, ok bool) {
+			screens.RemovePage("pipeline")
+			app.SetFocus(mainFocus)
+			if !ok {
+				return
+			}
+			// one confirmation for every job of the run
+			confirmRisk(p.Commands(), nil, func(ack []string) {
+				run, err := newPipelineRun(nextRun, p, t, runLauncher(ack))
+				if err != nil {
+					detail.SetText(tview.Escape(err.Error()))
+					return
+				}
+				nextRun++
+				run.OnChange = func(*PipelineRun) { go app.QueueUpdateDraw(pipeRuns.refresh) }
+				pipeRuns.add(run)
+				run.Start()
+				detail.SetText("Pipeline started - press " + keymap.Label("pipelines") + " to follow its steps")
+			}, func() { detail.SetText(errRiskCancelled.Error()) })
+		}), true, true)
+	}
+	// shardScan splits the targets of a scan into shards run as parallel
+	// jobs, merged into one XML at the end
+	shardScan := func() {
+		mainFocus = app.GetFocus()
+		screens.AddPage("shard", shardForm(lastCmdStr, cfg.Shard, func(cmdline string, sc ShardConfig, ok bool) {
+			screens.RemovePage("shard")
+			app.SetFocus(mainFocus)
+			if !ok {
+				return
+			}
+			args, err := splitArgs(cmdline)
+			if err != nil {
+				detail.SetText(tview.Escape(err.Error()))
+				return
+			}
+			if _, err := shardBase(args); err != nil {
+				detail.SetText(tview.Escape(err.Error()))
+				return
+			}
+			confirmRisk([]string{cmdline}, nil, func(ack []string) {
+				t := commandTarget(args, target)
+				dir, err := outputs.NewScanDir(t)
+				if err != nil {
+					detail.SetText(tview.Escape(err.Error()))
+					return
+				}
+				run, err := newShardRun(nextRun, cmdline, dir, sc, runLauncher(ack))
+				if err != nil {
+					detail.SetText(tview.Escape(err.Error()))
+					return
+				}
+				_ = outputs.Record(IndexEntry{Name: "Sharded scan", Target: t, Dir: dir, Cmd: cmdline})
+				nextRun++
+				run.OnChange = func(*ShardRun) { go app.QueueUpdateDraw(pipeRuns.refresh) }
+				pipeRuns.add(run)
+				run.Start()
+				detail.SetText(fmt.Sprintf("Sharded scan started: %d shards - press %s to follow them", len(run.Shards()), keymap.Label("pipelines")))
+			}, func() { detail.SetText(errRiskCancelled.Error()) })
+		}), true, true)
+	}
+	showPipelines := func() {
+		mainFocus = app.GetFocus()
+		pipeRuns.refresh()
+		screens.SwitchToPage("pipelines")
+		app.SetFocus(pipeRuns.view)
+	}
+	queueJob := func() {
+		if lastPipeline != nil {
+			queuePipeline(*lastPipeline)
+			return
+		}
+		mainFocus = app.GetFocus()
+		name, built := lastCmdName, lastCmdBuilt
+		screens.AddPage("queue", queueForm(lastCmdStr, func(cmdline string, ok bool) {
+			screens.RemovePage("queue")
+			app.SetFocus(mainFocus)
+			if !ok {
+				return
+			}
+			launch(name, cmdline, built, false, nil, queued)
+		}), true, true)
+	}
+	// editScriptArgs abre el editor de --script-args de los scripts elegidos
+	editScriptArgs := func() {
+		if len(nse.selected) == 0 {
+			detail.SetText("Select NSE scripts first (Enter or " + keymap.Label("nse_toggle") + "), then press " + keymap.Label("nse_args") + " to set their arguments")
+			return
+		}
+		mainFocus = app.GetFocus()
+		screens.AddPage("scriptargs", scriptArgsForm(nse.selectedScripts(), nse.args, nse.argsFile != "", func(args []ScriptArg, toFile bool, ok bool) {
+			screens.RemovePage("scriptargs")
+			app.SetFocus(mainFocus)
+			if !ok {
+				return
+			}
+			file := ""
+			if toFile && len(args) > 0 {
+				var err error
+				if file, err = writeScriptArgsFile(outputs.Dir(), args); err != nil {
+					detail.SetText(tview.Escape(err.Error()))
+					return
+				}
+				detail.SetText("Script args written to " + tview.Escape(file))
+			}
+			nse.setArgs(args, file)
+		}), true, true)
+	}
+	nse.onArgs = editScriptArgs
+	// twoPhase queues a sweep and, when it is done, a deep scan of the open
+	// ports of every host it found
+	twoPhase := func() {
+		mainFocus = app.GetFocus()
+		screens.AddPage("twophase", twoPhaseForm(builderCmd(), "-sCV", func(sweep, deep string, ok bool) {
+			screens.RemovePage("twophase")
+			app.SetFocus(mainFocus)
+			if !ok {
+				return
+			}
+			// both phases are confirmed now, phase 2 starts unattended
+			confirmRisk([]string{sweep, "nmap " + deep}, nil, func(ack []string) {
+				phase2 := func(j *Job) {
+					run, err := sweepResults(j)
+					go app.QueueUpdateDraw(func() {
+						if err != nil {
+							detail.SetText("[red]Two-phase scan stopped after phase 1:[-] " + tview.Escape(err.Error()))
+							return
+						}
+						scans := deepScanCommands(run, deep)
+						detail.SetText(fmt.Sprintf("Phase 1 (job #%d) done: %d hosts with open ports, %d deep scans queued - press %s to see them",
+							j.ID, len(scans), len(scans), keymap.Label("jobs")))
+						for _, d := range scans {
+							launch("Phase 2: "+d.Host, d.Cmd, true, false, ack, func(_ *Job, err error) {
+								if err != nil {
+									detail.SetText(tview.Escape(err.Error()))
+								}
+							})
+						}
+					})
+				}
+				launch("Phase 1: sweep", sweep, true, true, ack, func(_ *Job, err error) {
+					if err != nil {
+						queued(nil, err)
+						return
+					}
+					detail.SetText("Phase 1 queued - phase 2 starts when it finishes")
+				}, Then(phase2))
+			}, func() { detail.SetText(errRiskCancelled.Error()) })
+		}), true, true)
+	}
+	// runChecked prepares a command already checked and confirmed, and
+	// exits with it
+	runChecked := func(cmdline string) {
+		exit := func(cmd string) {
+			runAfter = true
+			finalCmd = cmd
+			app.Stop()
+		}
+		cmdline, err := prepareScan(workspace, outputs, nse.scripts, lastCmdName, cmdline, target, lastCmdBuilt, false)
+		if err != nil {
+			detail.SetText(tview.Escape(err.Error()))
+			return
+		}
+		cmdline = nmapInfo.Command(cmdline)
+		args, err := splitArgs(cmdline)
+		if err != nil || !needsRoot(args) || priv.Root {
+			exit(cmdline)
+			return
+		}
+		if priv.NmapCaps && runsNmap(args) {
+			exit(joinArgs(withPrivileged(args)))
+			return
+		}
+		page, back := newPrompt("sudo")
+		ask := tview.NewModal().
+			SetText(privilegeHint(priv) + "\n\n" + cmdline).
+			AddButtons([]string{"Run with sudo", "Run anyway", "Cancel"}).
+			SetDoneFunc(func(_ int, label string) {
+				screens.RemovePage(page)
+				app.SetFocus(back)
+				switch label {
+				case "Run with sudo":
+					exit(joinArgs(append([]string{"sudo"}, args...)))
+				case "Run anyway":
+					exit(cmdline)
+				}
+			})
+		screens.AddPage(page, ask, true, true)
+	}
+	// runAndExit leaves the TUI and runs cmdline in the terminal, through
+	// sudo if the user agrees (sudo then prompts in the terminal), and asks
+	// for typed confirmation of risky NSE scripts first.
+	runAndExit := func(cmdline string) {
+		args, err := splitArgs(cmdline)
+		if err != nil {
+			detail.SetText(tview.Escape(err.Error()))
+			return
+		}
+		if err := checkScanner(nmapInfo, args); err != nil {
+			detail.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+			return
+		}
+		if err := workspace.CheckScripts(args, nse.scripts); err != nil {
+			detail.SetText(tview.Escape(err.Error()))
+			return
+		}
+		confirmRisk([]string{cmdline}, nil, func([]string) { runChecked(cmdline) }, func() {})
+	}
+
+	// switchWorkspace makes ws the active workspace
+	switchWorkspace := func(ws *Workspace) {
+		workspace = ws
+		outputs = newOutputManager(workspaceOutput(cfg.Output, ws))
+		results = newResultsDB(ws)
+		explainer.Redactor.Reset(wsRedact(ws))
+		nse.setForbidden(ws.Forbidden())
+		if t := ws.Target(); t != "" {
+			target = t
+		}
+		loadCustomList()
+		update()
+		setHelper()
+		detail.SetText("Workspace " + tview.Escape(ws.Name))
+	}
+	var wsPage *workspacePage
+	wsPage = newWorkspacePage(func(name string) {
+		ws, err := openWorkspace(name)
+		if err != nil {
+			wsPage.info.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+			return
+		}
+		switchWorkspace(ws)
+		showMain()
+	})
+	showWorkspaces := func() {
+		mainFocus = app.GetFocus()
+		cur := ""
+		if workspace != nil {
+			cur = workspace.Name
+		}
+		wsPage.refresh(cur)
+		screens.SwitchToPage("workspaces")
+		app.SetFocus(wsPage.list)
+	}
+	newWorkspace := func() {
+		screens.AddPage("newws", newWorkspaceForm(func(name, targets string, ok bool) {
+			screens.RemovePage("newws")
+			app.SetFocus(wsPage.list)
+			if !ok {
+				return
+			}
+			ws, err := openWorkspace(name)
+			if err == nil {
+				for _, t := range strings.Fields(targets) {
+					if err = ws.AddTarget(t); err != nil {
+						break
+					}
+				}
+			}
+			if err != nil {
+				wsPage.info.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+				return
+			}
+			switchWorkspace(ws)
+			showMain()
+		}), true, true)
+	}
+
 	app.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		front, _ := screens.GetFrontPage()
+		if _, ok := keyContexts[front]; !ok {
+			return ev // modal form open
+		}
+		focus := app.GetFocus()
+		ctx := front
+		if focus == nseList {
+			ctx = "nse"
+		}
+		// las acciones de una sola letra no saltan en campos de texto (ver Keymap.Action)
+		action := keymap.Action(ctx, ev, focus)
+		if front == "workspaces" && action == "" && ev.Key() == tcell.KeyEnter && wsPage.isNewItem() {
+			newWorkspace()
+			return nil
+		}
+		switch action {
+		case "":
+			return ev
+		// ----- pantallas -----
+		case "back":
+			showMain()
+		case "jobs":
+			if front == "jobs" {
+				showMain()
+			} else {
+				showJobs()
+			}
+		case "pipelines":
+			if front == "pipelines" {
+				showMain()
+			} else {
+				showPipelines()
+			}
+		case "results_db":
+			if front == "query" {
+				showMain()
+			} else {
+				showQuery()
+			}
+		case "import":
+			if front == "import" {
+				showMain()
+			} else {
+				showImport()
+			}
+		case "workspaces":
+			if front == "workspaces" {
+				showMain()
+			} else {
+				showWorkspaces()
+			}
+		case "up":
+			return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+		case "down":
+			return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+		case "report":
+			reportOfQuery()
+		case "focus_query":
+			app.SetFocus(query.input)
+		case "job_cancel", "job_kill", "job_pause", "job_resume":
+			jobs.handleAction(action)
+		case "import_mark", "import_mark_all":
+			importer.handleAction(action)
+		case "nse_toggle", "nse_search", "nse_clear", "nse_args":
+			nse.handleAction(action)
 		// ----- Tab navigation -----
-		if ev.Key() == tcell.KeyTab || (ev.Key() == tcell.KeyRune && ev.Rune() == '\t') {
-			switch app.GetFocus() {
+		case "focus_next":
+			switch focus {
 			case hostList, scanList, portList, timeList, evasList, nseList:
 				app.SetFocus(customList)
 			case customList:
@@ -312,145 +971,122 @@ func main() {
 				app.SetFocus(hostList)
 				pages.SwitchToPage("host")
 			}
-			return nil
-		}
 		// Solo cambiar página si el foco está en una de las 6 listas principales
-		for i, l := range tabOrder[:6] {
-			if app.GetFocus() == l {
-				if ev.Key() == tcell.KeyRight && i < 5 {
+		case "next_list", "prev_list":
+			for i, l := range tabOrder[:6] {
+				if focus != l {
+					continue
+				}
+				if action == "next_list" && i < 5 {
 					app.SetFocus(tabOrder[i+1])
 					pages.SwitchToPage(order[i+1])
 					return nil
 				}
-				if ev.Key() == tcell.KeyLeft && i > 0 {
+				if action == "prev_list" && i > 0 {
 					app.SetFocus(tabOrder[i-1])
 					pages.SwitchToPage(order[i-1])
 					return nil
 				}
 			}
-		}
+			return ev
 		// Acciones especiales
-		if ev.Key() == tcell.KeyRune && ev.Rune() == 'x' && app.GetFocus() != copyBtn {
-			explain(cmdView, detail)
-		}
-		if ev.Key() == tcell.KeyRune && ev.Rune() == 'E' && app.GetFocus() != copyBtn {
-			runAfter = true
-			finalCmd = lastCmdStr
-			app.Stop()
+		case "explain":
+			explain(app, explainer, cmdView, detail)
+		case "explain_results":
+			path := outputXMLPath(lastCmdStr)
+			if path == "" {
+				path = jobMgr.LatestXML()
+			}
+			explainResults(app, explainer, path, detail)
+		case "queue":
+			queueJob()
+		case "two_phase":
+			twoPhase()
+		case "shard":
+			shardScan()
+		case "backend":
+			chooseBackend()
+		case "theme":
+			if noColor() {
+				detail.SetText("NO_COLOR is set: themes are off")
+				return nil
+			}
+			applyTheme(nextTheme(themes))
+			detail.SetText("Theme " + tview.Escape(currentTheme.Name) + " - set \"theme\" in config.json to keep it")
+		case "run_exit":
+			if lastPipeline != nil {
+				detail.SetText("Pipelines run as jobs: press " + keymap.Label("queue") + " to start one")
+				return nil
+			}
+			runAndExit(lastCmdStr)
 		}
-		return ev
+		return nil
 	})
 
+	showRetries(app, explainer, detail)
+	if nmapInfo.Err != nil {
+		detail.SetText("[red]" + tview.Escape(nmapInfo.Err.Error()) + "[-]\nCommands can still be built and copied, but not run or queued.")
+	}
+
 	// layout principal: body arriba, barra de comando abajo
 	left := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(helper, 3, 0, false).
 		AddItem(pages, 0, 7, true).
 		AddItem(customList, 0, 3, false)
-	left.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(left, themePlain)
 
 	right := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(selDesc, 0, 4, false).
 		AddItem(detail, 0, 8, false)
-	right.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(right, themePlain)
 
 	mainBody := tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(left, 0, 1, true).
 		AddItem(right, 0, 1, false)
-	mainBody.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(mainBody, themePlain)
 
 	// Barra inferior: comando + botón Copy
 	cmdBar := tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(cmdView, 0, 5, false).
 		AddItem(copyBtn, 12, 0, false)
-	cmdBar.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(cmdBar, themePlain)
 
 	rootFlex := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(mainBody, 0, 1, true).
 		AddItem(cmdBar, 3, 0, false)
-	rootFlex.SetBackgroundColor(tcell.ColorDarkBlue)
+	themed(rootFlex, themePlain)
+
+	screens.AddPage("main", rootFlex, true, true).
+		AddPage("jobs", jobs, true, false).
+		AddPage("workspaces", wsPage, true, false).
+		AddPage("query", query, true, false).
+		AddPage("import", importer, true, false).
+		AddPage("pipelines", pipeRuns, true, false)
 
-	if err := app.SetRoot(rootFlex, true).Run(); err != nil {
+	if err := app.SetRoot(screens, true).Run(); err != nil {
 		panic(err)
 	}
+	jobMgr.StopAll()
 
 	if runAfter {
 		// Split the command into parts and execute directly
-		cmdParts := strings.Split(finalCmd, " ")
+		cmdParts, err := splitArgs(finalCmd)
+		if err != nil || len(cmdParts) == 0 {
+			fmt.Fprintln(os.Stderr, "nmapx: cannot run command:", err)
+			os.Exit(1)
+		}
 		cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		_ = cmd.Run()
-	}
-}
-
-func explain(cmdView *tview.TextView, detail *tview.TextView) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		detail.SetText("OPENAI_API_KEY not set")
-		return
-	}
-
-	cmd := cmdView.GetText(true)
-	body := RequestBody{
-		Model: "gpt-4o-mini",
-		Messages: []Message{
-			{"system", "Summarize what this nmap command does in a security context. Be brief and skip any mention that it's an nmap command. Don't explain individual flags. Just describe the overall action and intent. Check if the command is valid or has conflicting options. If it's invalid, suggest a corrected version."},
-			{"user", cmd},
-		},
-	}
-
-	data, _ := json.Marshal(body)
-	req, _ := http.NewRequest("POST", apiURL, bytes.NewBuffer(data))
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		detail.SetText(err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	var rb ResponseBody
-	if err := json.NewDecoder(resp.Body).Decode(&rb); err != nil {
-		detail.SetText(err.Error())
-		return
-	}
-
-	if len(rb.Choices) > 0 {
-		detail.SetText(rb.Choices[0].Message.Content)
-	} else {
-		detail.SetText("No response from API")
+		if cmd.Run() == nil {
+			if path := resultsPath(finalCmd); path != "" {
+				n, err := results.storeFile(path)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "nmapx:", err)
+				} else {
+					fmt.Printf("nmapx: stored %d hosts in %s\n", n, results.path)
+				}
+			}
+		}
 	}
 }
-
-// copyToClipboard copia el texto al portapapeles en Mac y Linux
-func copyToClipboard(text string) error {
-	// Intentar pbcopy (Mac)
-	cmd := "pbcopy"
-	if _, err := os.Stat("/usr/bin/pbcopy"); err == nil {
-		c := execCommand(cmd)
-		c.Stdin = strings.NewReader(text)
-		return c.Run()
-	}
-	// Intentar xclip (Linux)
-	cmd = "xclip"
-	if _, err := os.Stat("/usr/bin/xclip"); err == nil {
-		c := execCommand(cmd, "-selection", "clipboard")
-		c.Stdin = strings.NewReader(text)
-		return c.Run()
-	}
-	// Intentar xsel (Linux)
-	cmd = "xsel"
-	if _, err := os.Stat("/usr/bin/xsel"); err == nil {
-		c := execCommand(cmd, "--clipboard", "--input")
-		c.Stdin = strings.NewReader(text)
-		return c.Run()
-	}
-	return fmt.Errorf("No clipboard utility found (pbcopy, xclip, xsel)")
-}
-
-// execCommand es un wrapper para exec.Command
-func execCommand(name string, arg ...string) *exec.Cmd {
-	return exec.Command(name, arg...)
-}
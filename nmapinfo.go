@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ---------- nmap binary detection ----------
+
+// NmapConfig configures which nmap binary is run.
+type NmapConfig struct {
+	Path string `json:"path"` // "" to look nmap up on $PATH
+}
+
+// NmapInfo is what `nmap --version` says about the installed nmap.
+type NmapInfo struct {
+	Path     string
+	Version  string // e.g. "7.94SVN"
+	Major    int
+	Minor    int
+	Platform string
+	With     []string // compiled-in features without versions: liblua, openssl, libssh2, ipv6 ...
+	Without  []string
+	// Err says why no working nmap was found.
+	Err error
+	// custom is set when the path comes from the config, so command
+	// lines must name it instead of relying on $PATH.
+	custom bool
+}
+
+// probeNmap locates nmap and reads its version and compiled features.
+func probeNmap(cfg NmapConfig) NmapInfo {
+	info := NmapInfo{Path: cfg.Path, custom: cfg.Path != ""}
+	if info.Path == "" {
+		path, err := exec.LookPath("nmap")
+		if err != nil {
+			info.Err = fmt.Errorf("nmap not found on $PATH: install it or set nmap.path in config.json")
+			return info
+		}
+		info.Path = path
+	}
+	out, err := execCommand(info.Path, "--version").Output()
+	if err != nil {
+		info.Err = fmt.Errorf("cannot run %s --version: %w", info.Path, err)
+		return info
+	}
+	parsed := parseNmapVersion(string(out))
+	if parsed.Version == "" {
+		info.Err = fmt.Errorf("%s does not look like nmap", info.Path)
+		return info
+	}
+	parsed.Path, parsed.custom = info.Path, info.custom
+	return parsed
+}
+
+var (
+	// Nmap version 7.94SVN ( https://nmap.org )
+	nmapVersionRe = regexp.MustCompile(`Nmap version (\d+)\.(\d+)\S*`)
+	// openssl-3.0.13, nmap-libssh2-1.11.0
+	featureVersionRe = regexp.MustCompile(`-\d[\w.]*$`)
+)
+
+// parseNmapVersion reads the output of nmap --version.
+func parseNmapVersion(out string) NmapInfo {
+	var info NmapInfo
+	features := func(s string) []string {
+		var names []string
+		for _, f := range strings.Fields(s) {
+			// bundled libraries are named nmap-liblua, nmap-libssh2 ...
+			names = append(names, strings.TrimPrefix(featureVersionRe.ReplaceAllString(f, ""), "nmap-"))
+		}
+		return names
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if m := nmapVersionRe.FindStringSubmatch(line); m != nil {
+			info.Version = strings.TrimPrefix(m[0], "Nmap version ")
+			info.Major, _ = strconv.Atoi(m[1])
+			info.Minor, _ = strconv.Atoi(m[2])
+			continue
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Platform":
+			info.Platform = strings.TrimSpace(val)
+		case "Compiled with":
+			info.With = features(val)
+		case "Compiled without":
+			info.Without = features(val)
+		}
+	}
+	return info
+}
+
+// Found reports whether a working nmap was found.
+func (n NmapInfo) Found() bool {
+	return n.Version != ""
+}
+
+// Check refuses a command line that runs nmap when none was found.
+func (n NmapInfo) Check(args []string) error {
+	if n.Found() {
+		return nil
+	}
+	for _, a := range args {
+		if filepath.Base(a) == "nmap" {
+			return n.Err
+		}
+		if a != "sudo" && !strings.HasPrefix(a, "-") {
+			break
+		}
+	}
+	return nil
+}
+
+// Has reports whether nmap was compiled with a feature.
+func (n NmapInfo) Has(feature string) bool {
+	for _, f := range n.With {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// atLeast reports whether nmap is version major.minor or newer.
+func (n NmapInfo) atLeast(major, minor int) bool {
+	return n.Major > major || n.Major == major && n.Minor >= minor
+}
+
+func (n NmapInfo) String() string {
+	if !n.Found() {
+		return "[red]nmap missing[-]"
+	}
+	return "nmap " + n.Version
+}
+
+// flagRequirements are the options that need a compiled-in feature or a
+// minimum nmap version, matched like rawFlags.
+var flagRequirements = []struct {
+	flag         string
+	feature      string
+	major, minor int
+}{
+	{flag: "-6", feature: "ipv6"},
+	{flag: "-sC", feature: "liblua"},
+	{flag: "-A", feature: "liblua"},
+	{flag: "--script", feature: "liblua"},
+	{flag: "--resolve-all", major: 7, minor: 70},
+	{flag: "--unique", major: 7, minor: 70},
+	{flag: "--discovery-ignore-rst", major: 7, minor: 80},
+}
+
+// Unsupported explains why this nmap cannot run an option, "" if it can or
+// if nmap was not found (nothing is known then).
+func (n NmapInfo) Unsupported(flag string) string {
+	f := strings.Fields(flag)
+	if !n.Found() || len(f) == 0 {
+		return ""
+	}
+	name, _, _ := strings.Cut(f[0], "=")
+	for _, r := range flagRequirements {
+		if name != r.flag {
+			continue
+		}
+		if r.feature != "" && !n.Has(r.feature) {
+			return fmt.Sprintf("%s needs nmap built with %s", r.flag, r.feature)
+		}
+		if r.major > 0 && !n.atLeast(r.major, r.minor) {
+			return fmt.Sprintf("%s needs nmap %d.%d or newer (this is %s)", r.flag, r.major, r.minor, n.Version)
+		}
+	}
+	return ""
+}
+
+// ScriptUnsupported explains why this nmap cannot run a script, from the
+// libraries the script requires.
+func (n NmapInfo) ScriptUnsupported(s NSEScript) string {
+	if !n.Found() {
+		return ""
+	}
+	if !n.Has("liblua") {
+		return "nmap was built without NSE (liblua)"
+	}
+	for _, lib := range s.Requires {
+		switch {
+		case lib == "openssl" && !n.Has("openssl"):
+			return s.Name + " needs nmap built with openssl"
+		case strings.HasPrefix(lib, "libssh2") && !n.Has("libssh2"):
+			return s.Name + " needs nmap built with libssh2"
+		}
+	}
+	return ""
+}
+
+// Command makes a command line run the configured nmap instead of the
+// one on $PATH.
+func (n NmapInfo) Command(cmdline string) string {
+	if !n.custom {
+		return cmdline
+	}
+	args, err := splitArgs(cmdline)
+	if err != nil {
+		return cmdline
+	}
+	for i, a := range args {
+		if a == "nmap" {
+			args[i] = n.Path
+			return joinArgs(args)
+		}
+		if a != "sudo" && !strings.HasPrefix(a, "-") {
+			break
+		}
+	}
+	return cmdline
+}
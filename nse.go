@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ---------- NSE script database ----------
+
+// NSEConfig configures where the NSE scripts are read from.
+type NSEConfig struct {
+	ScriptsDir string `json:"scripts_dir"` // "" to autodetect
+}
+
+// NSEScript is one script of nmap's scripts directory with the
+// documentation of its .nse header.
+type NSEScript struct {
+	Name        string
+	Categories  []string
+	Description string
+	Usage       string
+	Args        []NSEArg
+	Requires    []string // NSE libraries it loads: openssl, libssh2-utility ...
+}
+
+// NSEArg is one @args entry of a script.
+type NSEArg struct {
+	Name string
+	Desc string
+}
+
+// fallbackScripts are offered when nmap's scripts directory is not found.
+var fallbackScripts = []NSEScript{
+	{Name: "firewalk", Categories: []string{"safe", "discovery"}, Description: "Trace firewall rules"},
+	{Name: "ssl-enum-ciphers", Categories: []string{"discovery", "intrusive"}, Description: "Enumerate SSL ciphers"},
+	{Name: "dns-brute", Categories: []string{"intrusive", "discovery"}, Description: "Brute-force subdomains"},
+}
+
+// findScriptsDir returns the configured scripts directory, or looks for
+// the one of the installed nmap.
+func findScriptsDir(cfg NSEConfig, nmapPath string) (string, error) {
+	if cfg.ScriptsDir != "" {
+		if !isScriptsDir(cfg.ScriptsDir) {
+			return "", fmt.Errorf("nse.scripts_dir %s has no script.db or .nse files", cfg.ScriptsDir)
+		}
+		return cfg.ScriptsDir, nil
+	}
+	var dirs []string
+	if d := os.Getenv("NMAPDIR"); d != "" {
+		dirs = append(dirs, filepath.Join(d, "scripts"))
+	}
+	if nmapPath != "" {
+		if real, err := filepath.EvalSymlinks(nmapPath); err == nil {
+			nmapPath = real
+		}
+		bin := filepath.Dir(nmapPath)
+		dirs = append(dirs, filepath.Join(bin, "..", "share", "nmap", "scripts"))
+		if runtime.GOOS == "windows" {
+			dirs = append(dirs, filepath.Join(bin, "scripts"))
+		}
+	}
+	dirs = append(dirs,
+		"/usr/share/nmap/scripts",
+		"/usr/local/share/nmap/scripts",
+		"/opt/homebrew/share/nmap/scripts",
+	)
+	for _, d := range dirs {
+		if isScriptsDir(d) {
+			return filepath.Clean(d), nil
+		}
+	}
+	return "", fmt.Errorf("nmap scripts directory not found; set nse.scripts_dir in config.json")
+}
+
+// loadNSECatalog loads the scripts of the installed nmap. note says where
+// they came from, or why there are none.
+func loadNSECatalog(cfg NSEConfig, nmapPath string) (scripts []NSEScript, note string) {
+	dir, err := findScriptsDir(cfg, nmapPath)
+	if err == nil {
+		if scripts, err = loadScripts(dir); err == nil {
+			return scripts, "Scripts from " + dir
+		}
+	}
+	return nil, err.Error()
+}
+
+func isScriptsDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "script.db")); err == nil {
+		return true
+	}
+	nse, _ := filepath.Glob(filepath.Join(dir, "*.nse"))
+	return len(nse) > 0
+}
+
+// Entry { filename = "acarsd-info.nse", categories = { "discovery", "safe", } }
+var (
+	scriptDBRe = regexp.MustCompile(`filename\s*=\s*"([^"]+)\.nse"\s*,\s*categories\s*=\s*\{([^}]*)\}`)
+	quotedRe   = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// loadScripts lists every script of dir: names and categories from
+// script.db, documentation from each .nse file. Scripts not in script.db
+// (new or user scripts) are listed too.
+func loadScripts(dir string) ([]NSEScript, error) {
+	byName := make(map[string]*NSEScript)
+	var scripts []*NSEScript
+	add := func(name string) *NSEScript {
+		if s, ok := byName[name]; ok {
+			return s
+		}
+		s := &NSEScript{Name: name}
+		byName[name] = s
+		scripts = append(scripts, s)
+		return s
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "script.db")); err == nil {
+		for _, m := range scriptDBRe.FindAllStringSubmatch(string(data), -1) {
+			s := add(m[1])
+			for _, c := range quotedRe.FindAllStringSubmatch(m[2], -1) {
+				s.Categories = append(s.Categories, c[1])
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.nse"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		s := add(strings.TrimSuffix(filepath.Base(f), ".nse"))
+		cats, err := parseScriptHeader(f, s)
+		if err != nil {
+			continue // unreadable script: keep what script.db says
+		}
+		if len(s.Categories) == 0 {
+			s.Categories = cats
+		}
+	}
+	if len(scripts) == 0 {
+		return nil, fmt.Errorf("no scripts in %s", dir)
+	}
+
+	out := make([]NSEScript, len(scripts))
+	for i, s := range scripts {
+		out[i] = *s
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+var (
+	// docTagRe matches the NSEdoc tags of a header comment: "-- @args name text".
+	docTagRe = regexp.MustCompile(`^--\s*@(\w+)\s*(.*)$`)
+	// local openssl = stdnse.silent_require "openssl"
+	requireRe = regexp.MustCompile(`require\s*\(?\s*["']([\w.-]+)["']`)
+)
+
+// parseScriptHeader fills in the description, @usage and @args of a .nse
+// file, and returns its categories. Reading stops at the script's rules,
+// where the header ends.
+func parseScriptHeader(path string, s *NSEScript) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		cats    []string
+		desc    []string
+		inDesc  bool
+		tag     string // NSEdoc tag being read
+		usage   []string
+		lastArg = -1
+	)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if inDesc {
+			if i := strings.Index(line, "]]"); i >= 0 {
+				desc = append(desc, line[:i])
+				inDesc = false
+				continue
+			}
+			desc = append(desc, line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if m := requireRe.FindStringSubmatch(trimmed); m != nil && !strings.HasPrefix(trimmed, "--") {
+			s.Requires = append(s.Requires, m[1])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "description"):
+			rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "description"))
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+			switch {
+			case strings.HasPrefix(rest, "[["):
+				rest = rest[2:]
+				if i := strings.Index(rest, "]]"); i >= 0 {
+					desc = append(desc, rest[:i])
+				} else {
+					desc = append(desc, rest)
+					inDesc = true
+				}
+			case strings.HasPrefix(rest, `"`):
+				desc = append(desc, strings.Trim(rest, `"`))
+			}
+		case strings.HasPrefix(trimmed, "categories") && strings.Contains(trimmed, "{"):
+			for _, c := range quotedRe.FindAllStringSubmatch(trimmed, -1) {
+				cats = append(cats, c[1])
+			}
+		case strings.HasPrefix(trimmed, "portrule") || strings.HasPrefix(trimmed, "hostrule") ||
+			strings.HasPrefix(trimmed, "prerule") || strings.HasPrefix(trimmed, "postrule") ||
+			strings.HasPrefix(trimmed, "action"):
+			s.Description = cleanDoc(desc)
+			s.Usage = cleanDoc(usage)
+			return cats, nil
+		case strings.HasPrefix(trimmed, "--"):
+			if m := docTagRe.FindStringSubmatch(trimmed); m != nil {
+				tag = m[1]
+				switch tag {
+				case "usage":
+					if m[2] != "" {
+						usage = append(usage, m[2])
+					}
+				case "args", "arg":
+					name, text, _ := strings.Cut(m[2], " ")
+					if name != "" {
+						s.Args = append(s.Args, NSEArg{Name: name, Desc: strings.TrimSpace(text)})
+						lastArg = len(s.Args) - 1
+					}
+				}
+				continue
+			}
+			text := strings.TrimSpace(strings.TrimPrefix(trimmed, "--"))
+			if strings.Trim(text, "-") == "" {
+				text = "" // "---" opens the doc comment
+			}
+			switch {
+			case tag == "usage" && text != "":
+				usage = append(usage, text)
+			case (tag == "args" || tag == "arg") && lastArg >= 0 && text != "":
+				a := &s.Args[lastArg]
+				a.Desc = strings.TrimSpace(a.Desc + " " + text)
+			case text == "":
+				// a blank comment line ends @usage, @args continue lines
+				if tag == "usage" && len(usage) > 0 {
+					tag = ""
+				}
+			}
+		default:
+			tag = ""
+		}
+	}
+	s.Description = cleanDoc(desc)
+	s.Usage = cleanDoc(usage)
+	return cats, sc.Err()
+}
+
+// cleanDoc joins doc lines, dropping the blank lines at both ends.
+func cleanDoc(lines []string) string {
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Summary is the first sentence of the description.
+func (s NSEScript) Summary() string {
+	d := strings.Join(strings.Fields(s.Description), " ")
+	if i := strings.Index(d, ". "); i >= 0 {
+		d = d[:i+1]
+	}
+	return d
+}
+
+// HasCategory reports whether the script is in category c.
+func (s NSEScript) HasCategory(c string) bool {
+	for _, have := range s.Categories {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptMatch scores how well a search matches a script: every word of
+// query must match the name fuzzily (letters in order), a category, or the
+// description. Better name matches score higher; 0 means no match.
+func scriptMatch(s NSEScript, query string) int {
+	total := 0
+	desc := strings.ToLower(s.Description)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		score := fuzzyScore(word, s.Name)
+		if s.HasCategory(word) && score < 50 {
+			score = 50
+		}
+		if score == 0 && strings.Contains(desc, word) {
+			score = 1
+		}
+		if score == 0 {
+			return 0
+		}
+		total += score
+	}
+	if total == 0 {
+		return 1 // empty query matches everything
+	}
+	return total
+}
+
+// fuzzyScore matches the letters of pattern in order in s. Consecutive
+// letters and letters at the start of a word ("hsh" in http-slowloris-check)
+// score more. 0 means no match.
+func fuzzyScore(pattern, s string) int {
+	s = strings.ToLower(s)
+	if pattern == "" {
+		return 0
+	}
+	if s == pattern {
+		return 1000
+	}
+	score := 0
+	if strings.Contains(s, pattern) {
+		score = 200 + 10*len(pattern)
+		if strings.HasPrefix(s, pattern) {
+			score += 100
+		}
+		return score
+	}
+	p, rs := []rune(pattern), []rune(s)
+	k, prev := 0, -2
+	for i, r := range rs {
+		if k == len(p) {
+			break
+		}
+		if r != p[k] {
+			continue
+		}
+		score += 2
+		if i == prev+1 {
+			score += 5
+		}
+		if wordStart := i == 0 || !unicode.IsLetter(rs[i-1]) && !unicode.IsDigit(rs[i-1]); wordStart {
+			score += 8
+		}
+		prev = i
+		k++
+	}
+	if k < len(p) {
+		return 0
+	}
+	return score
+}
+
+// searchScripts returns the indexes of the scripts matching query, best first.
+func searchScripts(scripts []NSEScript, query string) []int {
+	type hit struct{ i, score int }
+	var hits []hit
+	for i, s := range scripts {
+		if score := scriptMatch(s, query); score > 0 {
+			hits = append(hits, hit{i, score})
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+	idx := make([]int, len(hits))
+	for k, h := range hits {
+		idx[k] = h.i
+	}
+	return idx
+}
+
+// scriptArg is the nmap option selecting the given scripts.
+func scriptArg(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return "--script=" + strings.Join(names, ",")
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// scriptBrowser is the NSE page of the builder: every script of nmap's
+// scripts directory with fuzzy search and multi-select.
+type scriptBrowser struct {
+	*tview.Flex
+	search   *tview.InputField
+	list     *tview.List
+	doc      *tview.TextView
+	scripts  []NSEScript
+	shown    []int    // index in scripts of each list item
+	selected []string // script names in the order they were picked
+	note     string   // where the scripts came from, or why there are none
+	args     []ScriptArg
+	argsFile string   // --script-args-file written for args, if any
+	forbid   []string // NSE categories the workspace forbids
+	// unsupported explains why the installed nmap cannot run a script
+	unsupported func(NSEScript) string
+	onChange    func() // called when the selection or the args change
+	onArgs      func() // nse_args: edit the script args
+	app         *tview.Application
+}
+
+func newScriptBrowser(app *tview.Application, onChange func()) *scriptBrowser {
+	b := &scriptBrowser{
+		app:      app,
+		search:   tview.NewInputField().SetLabel("/ "),
+		list:     tview.NewList().ShowSecondaryText(true),
+		doc:      tview.NewTextView().SetDynamicColors(true).SetWrap(true).SetWordWrap(true),
+		scripts:  fallbackScripts,
+		onChange: onChange,
+	}
+	themed(b.search, themePlain)
+	b.search.SetPlaceholder("fuzzy search: name, category or words of the description")
+	b.search.SetChangedFunc(func(string) { b.filter() })
+	b.search.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			b.search.SetText("")
+		}
+		app.SetFocus(b.list)
+	})
+
+	b.list.SetBorder(true)
+	themed(b.list, themeFocus)
+	b.list.SetSelectedFunc(func(i int, _, _ string, _ rune) { b.toggle(i) })
+	b.list.SetChangedFunc(func(i int, _, _ string, _ rune) { b.showDoc(i) })
+
+	b.doc.SetBorder(true).SetTitle("Script")
+	themed(b.doc, themePlain)
+
+	b.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.search, 1, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(b.list, 0, 1, true).
+			AddItem(b.doc, 0, 1, false), 0, 1, true)
+	themed(b.Flex, themePlain)
+	b.filter()
+	return b
+}
+
+// setScripts replaces the fallback scripts with the loaded ones. Selected
+// scripts are kept.
+func (b *scriptBrowser) setScripts(scripts []NSEScript, note string) {
+	if len(scripts) > 0 {
+		b.scripts = scripts
+	}
+	b.note = note
+	b.filter()
+}
+
+func (b *scriptBrowser) filter() {
+	b.shown = searchScripts(b.scripts, b.search.GetText())
+	b.redraw()
+	b.list.SetCurrentItem(0)
+	b.showDoc(0)
+}
+
+func (b *scriptBrowser) isSelected(name string) bool {
+	for _, s := range b.selected {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *scriptBrowser) redraw() {
+	cur := b.list.GetCurrentItem()
+	b.list.Clear()
+	for _, i := range b.shown {
+		s := b.scripts[i]
+		label := riskMark(s.Categories, b.forbid) + tview.Escape(s.Name)
+		if b.scriptUnsupported(s) != "" {
+			label = "[grey]✗ " + label + "[-]"
+		}
+		if b.isSelected(s.Name) {
+			label = "✓ " + label
+		}
+		b.list.AddItem(label, tview.Escape(strings.Join(s.Categories, ", ")), 0, nil)
+	}
+	b.list.SetCurrentItem(cur)
+	title := fmt.Sprintf("   💻 NSE %d/%d   ", len(b.shown), len(b.scripts))
+	if len(b.selected) > 0 {
+		title += fmt.Sprintf("%d selected   ", len(b.selected))
+	}
+	if n := len(b.scriptArgs()); n > 0 {
+		title += fmt.Sprintf("%d args   ", n)
+	}
+	b.list.SetTitle(title)
+}
+
+// handleAction runs the keymap actions of the script list.
+func (b *scriptBrowser) handleAction(action string) {
+	switch action {
+	case "nse_toggle":
+		b.toggle(b.list.GetCurrentItem())
+	case "nse_search":
+		b.app.SetFocus(b.search)
+	case "nse_clear":
+		b.selected = nil
+		b.redraw()
+		b.onChange()
+	case "nse_args":
+		if b.onArgs != nil {
+			b.onArgs()
+		}
+	}
+}
+
+func (b *scriptBrowser) toggle(i int) {
+	if i < 0 || i >= len(b.shown) {
+		return
+	}
+	s := b.scripts[b.shown[i]]
+	name := s.Name
+	if bad := forbiddenOf(s.Categories, b.forbid); len(bad) > 0 && !b.isSelected(name) {
+		b.doc.SetText(fmt.Sprintf("[red]%s is not allowed in this workspace: it is in %s[-]",
+			tview.Escape(name), strings.Join(bad, ", ")))
+		return
+	}
+	if why := b.scriptUnsupported(s); why != "" && !b.isSelected(name) {
+		b.doc.SetText("[yellow]" + tview.Escape(why) + "[-]")
+		return
+	}
+	if b.isSelected(name) {
+		var keep []string
+		for _, s := range b.selected {
+			if s != name {
+				keep = append(keep, s)
+			}
+		}
+		b.selected = keep
+	} else {
+		b.selected = append(b.selected, name)
+	}
+	b.redraw()
+	b.onChange()
+}
+
+// showDoc shows the header documentation of list item i.
+func (b *scriptBrowser) showDoc(i int) {
+	if i < 0 || i >= len(b.shown) {
+		b.doc.SetText(tview.Escape(b.note))
+		return
+	}
+	s := b.scripts[b.shown[i]]
+	var t strings.Builder
+	fmt.Fprintf(&t, "[yellow]%s[-]\n[grey]%s[-]\n", tview.Escape(s.Name), tview.Escape(strings.Join(s.Categories, ", ")))
+	if why := b.scriptUnsupported(s); why != "" {
+		fmt.Fprintf(&t, "[yellow]✗ %s[-]\n", tview.Escape(why))
+	}
+	if bad := forbiddenOf(s.Categories, b.forbid); len(bad) > 0 {
+		fmt.Fprintf(&t, "[red]⛔ forbidden in this workspace (%s)[-]\n", strings.Join(bad, ", "))
+	} else if risky := riskyOf(s.Categories); len(risky) > 0 {
+		fmt.Fprintf(&t, "[red]⚠ %s: may disrupt or break into the target[-]\n", strings.Join(risky, ", "))
+	}
+	fmt.Fprintf(&t, "\n%s\n", tview.Escape(s.Description))
+	if s.Usage != "" {
+		fmt.Fprintf(&t, "\n[green]Usage[-]\n%s\n", tview.Escape(s.Usage))
+	}
+	if len(s.Args) > 0 {
+		t.WriteString("\n[green]Arguments[-]\n")
+		for _, a := range s.Args {
+			fmt.Fprintf(&t, "[white]%s[-] %s\n", tview.Escape(a.Name), tview.Escape(a.Desc))
+		}
+	}
+	if b.note != "" {
+		fmt.Fprintf(&t, "\n[grey]%s[-]", tview.Escape(b.note))
+	}
+	b.doc.SetText(t.String())
+	b.doc.ScrollToBeginning()
+}
+
+func (b *scriptBrowser) scriptUnsupported(s NSEScript) string {
+	if b.unsupported == nil {
+		return ""
+	}
+	return b.unsupported(s)
+}
+
+// setForbidden applies a workspace's forbidden categories. Selected
+// scripts in them are deselected.
+func (b *scriptBrowser) setForbidden(forbid []string) {
+	b.forbid = forbid
+	var keep []string
+	for _, s := range b.selectedScripts() {
+		if len(forbiddenOf(s.Categories, forbid)) == 0 {
+			keep = append(keep, s.Name)
+		}
+	}
+	b.selected = keep
+	b.redraw()
+	b.showDoc(b.list.GetCurrentItem())
+}
+
+// selectedScripts returns the selected scripts in the order they were picked.
+func (b *scriptBrowser) selectedScripts() []NSEScript {
+	var out []NSEScript
+	for _, name := range b.selected {
+		for _, s := range b.scripts {
+			if s.Name == name {
+				out = append(out, s)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// scriptArgs are the args of the selected scripts plus those typed by hand.
+func (b *scriptBrowser) scriptArgs() []ScriptArg {
+	var out []ScriptArg
+	for _, a := range b.args {
+		if a.Script == "" || b.isSelected(a.Script) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// setArgs keeps the args from the editor; file is the --script-args-file
+// written for them, or "".
+func (b *scriptBrowser) setArgs(args []ScriptArg, file string) {
+	b.args, b.argsFile = args, file
+	b.redraw()
+	b.onChange()
+}
+
+// Arg is the --script option for the selected scripts, with their
+// --script-args, "" for none.
+func (b *scriptBrowser) Arg() string {
+	arg := scriptArg(b.selected)
+	if arg == "" {
+		return ""
+	}
+	if opt := scriptArgsOption(b.scriptArgs(), b.argsFile); opt != "" {
+		arg += " " + opt
+	}
+	return arg
+}
+
+// scriptArgsForm edits the --script-args of the selected scripts: one
+// field per argument documented in their headers, and a field for any
+// other name=value pairs.
+func scriptArgsForm(scripts []NSEScript, current []ScriptArg, toFile bool, done func(args []ScriptArg, toFile bool, ok bool)) tview.Primitive {
+	type field struct {
+		script string
+		arg    NSEArg
+		input  *tview.InputField
+	}
+	values := make(map[string]string)
+	var other []ScriptArg
+	documented := make(map[string]bool)
+	for _, s := range scripts {
+		for _, a := range s.Args {
+			documented[a.Name] = true
+		}
+	}
+	for _, a := range current {
+		if documented[a.Name] {
+			values[a.Name] = a.Value
+		} else {
+			other = append(other, a)
+		}
+	}
+
+	form := tview.NewForm()
+	var fields []field
+	var undocumented []string
+	seen := make(map[string]bool)
+	for _, s := range scripts {
+		if len(s.Args) == 0 {
+			undocumented = append(undocumented, s.Name)
+		}
+		for _, a := range s.Args {
+			if seen[a.Name] {
+				continue // library args shared by several scripts
+			}
+			seen[a.Name] = true
+			in := tview.NewInputField().SetLabel(a.Name).SetText(values[a.Name]).SetPlaceholder(a.Desc)
+			in.SetPlaceholderTextColor(tcell.ColorGrey)
+			form.AddFormItem(in)
+			fields = append(fields, field{s.Name, a, in})
+		}
+	}
+	otherField := tview.NewInputField().SetLabel("Other args").SetText(formatScriptArgs(other)).
+		SetPlaceholder("name=value,name2=\"a, b\"")
+	otherField.SetPlaceholderTextColor(tcell.ColorGrey)
+	form.AddFormItem(otherField)
+	form.AddCheckbox("Use --script-args-file", toFile, nil)
+	status := tview.NewTextView().SetDynamicColors(true)
+	if len(undocumented) > 0 {
+		status.SetText("No documented arguments: " + tview.Escape(strings.Join(undocumented, ", ")))
+	}
+	form.AddFormItem(status.SetLabel("").SetSize(2, 0))
+
+	form.AddButton("Apply", func() {
+		var args []ScriptArg
+		for _, f := range fields {
+			v := strings.TrimSpace(f.input.GetText())
+			if v == "" {
+				continue
+			}
+			if err := validateScriptArg(f.arg, v); err != nil {
+				status.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+				return
+			}
+			args = append(args, ScriptArg{Script: f.script, Name: f.arg.Name, Value: v})
+		}
+		extra, err := parseScriptArgs(otherField.GetText())
+		if err != nil {
+			status.SetText("[red]Other args: " + tview.Escape(err.Error()) + "[-]")
+			return
+		}
+		args = append(args, extra...)
+		file := form.GetFormItemByLabel("Use --script-args-file").(*tview.Checkbox).IsChecked()
+		done(args, file, true)
+	})
+	form.AddButton("Clear", func() { done(nil, false, true) })
+	form.AddButton("Cancel", func() { done(nil, false, false) })
+	form.SetCancelFunc(func() { done(nil, false, false) })
+	form.SetBorder(true).SetTitle("Script arguments")
+	paintWidget(form, themePlain)
+	height := 2*len(fields) + 12
+	if height > 30 {
+		height = 30 // the form scrolls
+	}
+	return modal(form, 110, height)
+}
+
+// riskConfirmForm asks the user to type the risky NSE categories of a
+// command before it is run.
+func riskConfirmForm(cmdline string, risky []string, done func(ok bool)) tview.Primitive {
+	want := strings.Join(risky, ",")
+	form := tview.NewForm()
+	form.AddTextView("", fmt.Sprintf("[red]This command runs NSE scripts in: %s[-]\nThey can crash services, lock accounts or change data on the target.\n\n%s",
+		want, tview.Escape(cmdline)), 0, 5, true, false)
+	form.AddInputField("Type \""+want+"\" to run", "", 0, nil, nil)
+	status := tview.NewTextView().SetDynamicColors(true)
+	form.AddFormItem(status.SetLabel("").SetSize(1, 0))
+	form.AddButton("Run", func() {
+		if strings.TrimSpace(form.GetFormItem(1).(*tview.InputField).GetText()) != want {
+			status.SetText("[red]The text does not match[-]")
+			return
+		}
+		done(true)
+	})
+	form.AddButton("Cancel", func() { done(false) })
+	form.SetCancelFunc(func() { done(false) })
+	form.SetFocus(1)
+	form.SetBorder(true).SetTitle("Confirm risky scripts")
+	paintWidget(form, themePlain)
+	return modal(form, 100, 15)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ---------- NSE category safety ----------
+
+// riskyCategories are the NSE categories whose scripts can crash services,
+// lock accounts or break into the scanned systems.
+var riskyCategories = []string{"intrusive", "dos", "brute", "exploit", "vuln"}
+
+// nseCategories are all the categories nmap knows, for "all" and for
+// telling categories from script names in --script expressions.
+var nseCategories = []string{
+	"auth", "broadcast", "brute", "default", "discovery", "dos", "exploit",
+	"external", "fuzzer", "intrusive", "malware", "safe", "version", "vuln",
+}
+
+func isCategory(name string) bool {
+	for _, c := range nseCategories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptExprs returns the --script expressions of a command line.
+func scriptExprs(args []string) []string {
+	var exprs []string
+	for i, a := range args {
+		switch {
+		case strings.HasPrefix(a, "--script="):
+			exprs = append(exprs, strings.TrimPrefix(a, "--script="))
+		case a == "--script" && i+1 < len(args):
+			exprs = append(exprs, args[i+1])
+		}
+	}
+	return exprs
+}
+
+// commandScriptCategories returns the NSE categories a command line can
+// run, sorted: the categories named in its --script expressions, the
+// categories of the scripts it names or matches with globs, and "default"
+// for -sC and -A. Terms after "not" are left out.
+func commandScriptCategories(args []string, scripts []NSEScript) []string {
+	cats := make(map[string]bool)
+	for _, a := range args {
+		if a == "-sC" || a == "-A" {
+			cats["default"] = true
+		}
+	}
+	for _, expr := range scriptExprs(args) {
+		words := strings.FieldsFunc(expr, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '(' || r == ')'
+		})
+		negate := false
+		for _, w := range words {
+			switch w = strings.TrimPrefix(strings.ToLower(w), "+"); w {
+			case "not":
+				negate = true
+				continue
+			case "and", "or":
+				continue
+			}
+			if negate {
+				negate = false
+				continue
+			}
+			switch {
+			case w == "all":
+				for _, c := range nseCategories {
+					cats[c] = true
+				}
+			case isCategory(w):
+				cats[w] = true
+			default:
+				// script name, file or glob
+				name := strings.TrimSuffix(filepath.Base(w), ".nse")
+				found := false
+				for _, s := range scripts {
+					if ok, _ := filepath.Match(name, s.Name); ok {
+						found = true
+						for _, c := range s.Categories {
+							cats[c] = true
+						}
+					}
+				}
+				if !found {
+					for _, c := range guessCategories(name) {
+						cats[c] = true
+					}
+				}
+			}
+		}
+	}
+	out := make([]string, 0, len(cats))
+	for c := range cats {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// nameCategories maps words of script names to the category they betray
+// (smb-vuln-ms17-010, ftp-brute, ftp-vsftpd-backdoor).
+var nameCategories = map[string]string{
+	"vuln": "vuln", "vulns": "vuln", "cve": "vuln",
+	"brute": "brute", "bruteforce": "brute",
+	"dos": "dos", "flood": "dos", "slowloris": "dos",
+	"exploit": "exploit", "backdoor": "exploit", "shellshock": "exploit",
+}
+
+// guessCategories classifies a script name or glob that matches none of the
+// loaded scripts: nmap was not found, the script is newer than the list or
+// is a file of one's own. Names that betray nothing count as intrusive, so
+// scripts NmapX does not know are confirmed like risky ones.
+func guessCategories(name string) []string {
+	var cats []string
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == '*' || r == '?' }) {
+		if c, ok := nameCategories[word]; ok {
+			cats = append(cats, c)
+		}
+	}
+	if len(cats) == 0 {
+		cats = []string{"intrusive"}
+	}
+	return cats
+}
+
+// riskyCommands returns the risky NSE categories that any of cmdlines can
+// run, sorted.
+func riskyCommands(cmdlines []string, scripts []NSEScript) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, cmdline := range cmdlines {
+		args, err := splitArgs(cmdline)
+		if err != nil {
+			continue
+		}
+		for _, c := range riskyOf(commandScriptCategories(args, scripts)) {
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// unconfirmed keeps the categories of risky that are not in ack.
+func unconfirmed(risky, ack []string) []string {
+	var out []string
+	for _, c := range risky {
+		if !inList(ack, c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// riskyOf keeps the risky categories of cats.
+func riskyOf(cats []string) []string {
+	var out []string
+	for _, c := range cats {
+		for _, r := range riskyCategories {
+			if c == r {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// forbiddenOf keeps the categories of cats that forbid lists.
+func forbiddenOf(cats, forbid []string) []string {
+	var out []string
+	for _, c := range cats {
+		for _, f := range forbid {
+			if c == strings.ToLower(f) {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// riskMark flags a command or script in the lists: ⛔ when the workspace
+// forbids one of its categories, ⚠ when it has risky ones.
+func riskMark(cats, forbid []string) string {
+	switch {
+	case len(forbiddenOf(cats, forbid)) > 0:
+		return "⛔ "
+	case len(riskyOf(cats)) > 0:
+		return "⚠ "
+	}
+	return ""
+}
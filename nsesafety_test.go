@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRiskyCommands(t *testing.T) {
+	scripts := []NSEScript{
+		{Name: "http-title", Categories: []string{"default", "discovery", "safe"}},
+		{Name: "smb-vuln-ms17-010", Categories: []string{"safe", "vuln"}},
+		{Name: "ftp-brute", Categories: []string{"brute", "intrusive"}},
+	}
+	tests := []struct {
+		cmd     string
+		scripts []NSEScript
+		want    []string
+	}{
+		{"nmap -sV 10.0.0.1", scripts, nil},
+		{"nmap --script http-title 10.0.0.1", scripts, nil},
+		{"nmap --script smb-vuln-* 10.0.0.1", scripts, []string{"vuln"}},
+		{"nmap --script=ftp-brute 10.0.0.1", scripts, []string{"brute", "intrusive"}},
+		{`nmap --script "default and not intrusive" 10.0.0.1`, scripts, nil},
+		{"nmap --script vuln,safe 10.0.0.1", nil, []string{"vuln"}},
+		// scripts missing from the database are classified by name
+		{"nmap --script smb-vuln-* 10.0.0.1", nil, []string{"vuln"}},
+		{"nmap --script smb-vuln-cve-2020-0796 10.0.0.1", scripts, []string{"vuln"}},
+		{"nmap --script ftp-vsftpd-backdoor 10.0.0.1", nil, []string{"exploit"}},
+		{"nmap --script http-slowloris 10.0.0.1", nil, []string{"dos"}},
+		{"nmap --script ./mine.nse 10.0.0.1", scripts, []string{"intrusive"}},
+		{"nmap --script http-title 10.0.0.1", nil, []string{"intrusive"}},
+	}
+	for _, tt := range tests {
+		if got := riskyCommands([]string{tt.cmd}, tt.scripts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("riskyCommands(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestRiskyCommandsUnion(t *testing.T) {
+	p := Pipeline{Steps: []PipelineStep{
+		{Name: "sweep", Args: "-sn"},
+		{Name: "vulns", Args: "-sV --script vuln"},
+		{Name: "logins", Args: "--script brute"},
+	}}
+	risky := riskyCommands(p.Commands(), nil)
+	if want := []string{"brute", "vuln"}; !reflect.DeepEqual(risky, want) {
+		t.Fatalf("riskyCommands = %q, want %q", risky, want)
+	}
+	if got := unconfirmed(risky, []string{"vuln"}); !reflect.DeepEqual(got, []string{"brute"}) {
+		t.Errorf("unconfirmed = %q", got)
+	}
+	if got := unconfirmed(risky, risky); got != nil {
+		t.Errorf("unconfirmed after confirming all = %q", got)
+	}
+}
+
+func TestCheckPipelineRisk(t *testing.T) {
+	p := Pipeline{Name: "deep", Steps: []PipelineStep{
+		{Name: "sweep", Args: "-sn"},
+		{Name: "vulns", Args: "-sV --script vuln,ftp-brute"},
+	}}
+	tests := []struct {
+		confirm string
+		wantErr bool
+	}{
+		{"", true},
+		{"vuln", true},
+		{"vuln,brute", false},
+		{" Brute , VULN ", false},
+		{"vuln,brute,dos", false},
+	}
+	for _, tt := range tests {
+		err := checkPipelineRisk(p, nil, categoryList(tt.confirm))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("--confirm-risky %q: err = %v", tt.confirm, err)
+		}
+	}
+	safe := Pipeline{Name: "safe", Steps: []PipelineStep{{Name: "versions", Args: "-sCV"}}}
+	if err := checkPipelineRisk(safe, nil, nil); err != nil {
+		t.Errorf("safe pipeline refused: %v", err)
+	}
+}
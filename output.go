@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputConfig configures where scan output files go.
+type OutputConfig struct {
+	Dir      string `json:"dir"`      // engagement directory
+	AutoOA   bool   `json:"auto_oa"`  // add -oA to built commands
+	Relocate bool   `json:"relocate"` // move relative -o* paths of custom commands into the scan folder
+}
+
+// outputFlags are nmap's file output options; all take a path argument.
+var outputFlags = map[string]bool{"-oN": true, "-oX": true, "-oG": true, "-oS": true, "-oA": true, "-oM": true}
+
+// backendOutputFlags are the file output options of the other backends.
+var backendOutputFlags = map[string]map[string]bool{
+	"masscan": {"-oJ": true, "-oX": true, "-oG": true, "-oL": true, "-oB": true},
+	"naabu":   {"-o": true, "-output": true},
+}
+
+// IndexEntry is one line of index.jsonl in the engagement directory.
+type IndexEntry struct {
+	Time   time.Time `json:"time"`
+	Name   string    `json:"name"`
+	Target string    `json:"target"`
+	Dir    string    `json:"dir"`
+	Cmd    string    `json:"cmd"`
+}
+
+// OutputManager gives every scan its own folder under the engagement
+// directory and keeps an index of all of them.
+type OutputManager struct {
+	cfg OutputConfig
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+func newOutputManager(cfg OutputConfig) *OutputManager {
+	return &OutputManager{cfg: cfg, now: time.Now}
+}
+
+// Dir is the engagement directory.
+func (o *OutputManager) Dir() string {
+	return o.cfg.Dir
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewScanDir creates <dir>/<target>_<timestamp>, adding -2, -3 … if it exists.
+func (o *OutputManager) NewScanDir(target string) (string, error) {
+	name := strings.Trim(unsafeName.ReplaceAllString(target, "_"), "_")
+	if name == "" {
+		name = "scan"
+	}
+	base := filepath.Join(o.cfg.Dir, name+"_"+o.now().Format("20060102-150405"))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := os.MkdirAll(o.cfg.Dir, 0o755); err != nil {
+		return "", err
+	}
+	dir := base
+	for n := 2; ; n++ {
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		dir = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// Prepare gives a scanner command line its own scan folder. Built commands
+// without output options get -oA <folder>/scan, or the output options of
+// their backend; relative output paths in custom commands are moved into
+// the folder. With results, the command writes a results file whatever the
+// config says: when it has none, nmap gets -oX <folder>/scan.xml and other
+// backends their own output options. Commands that run no scanner, or that
+// need nothing changed, are returned as they are with dir "".
+func (o *OutputManager) Prepare(args []string, target string, built, results bool) ([]string, string, error) {
+	b, _ := commandBackend(args)
+	if b == nil {
+		return args, "", nil
+	}
+	var outputs []int
+	for i, a := range args {
+		if a == "--resume" {
+			return args, "", nil
+		}
+		if (outputFlags[a] || backendOutputFlags[b.Name()][a]) && i+1 < len(args) {
+			outputs = append(outputs, i+1)
+		}
+	}
+	inject := built && o.cfg.AutoOA && len(outputs) == 0
+	xml := results && !inject && b.outputPath(args) == ""
+	var relocate []int
+	if o.cfg.Relocate {
+		for _, i := range outputs {
+			if args[i] != "-" && !filepath.IsAbs(args[i]) {
+				relocate = append(relocate, i)
+			}
+		}
+	}
+	if !inject && !xml && len(relocate) == 0 {
+		return args, "", nil
+	}
+
+	dir, err := o.NewScanDir(target)
+	if err != nil {
+		return args, "", err
+	}
+	out := append([]string(nil), args...)
+	for _, i := range relocate {
+		out[i] = filepath.Join(dir, args[i])
+	}
+	switch {
+	case inject:
+		out = b.withOutput(out, filepath.Join(dir, "scan"))
+	case xml && b.Name() == "nmap":
+		// -oX alone: the command may already write the other formats
+		out = append(out, "-oX", filepath.Join(dir, "scan.xml"))
+	case xml:
+		out = b.withOutput(out, filepath.Join(dir, "scan"))
+	}
+	return out, dir, nil
+}
+
+// Record appends a scan to index.jsonl.
+func (o *OutputManager) Record(e IndexEntry) error {
+	if e.Time.IsZero() {
+		e.Time = o.now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(o.cfg.Dir, "index.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Index reads every scan recorded in index.jsonl, oldest first.
+func (o *OutputManager) Index() ([]IndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(o.cfg.Dir, "index.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []IndexEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e IndexEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// commandTarget guesses the scan target of a command line for folder names:
+// its first target, skipping options and their values wherever they are.
+func commandTarget(args []string, fallback string) string {
+	if t := scanTargets(args); len(t) > 0 {
+		return t[0]
+	}
+	return fallback
+}
+
+// prepareScan readies a command line before it is queued or run: targets
+// outside the workspace scope and NSE scripts in categories it forbids
+// (classified with scripts) are refused, the scan gets its own folder,
+// and it is recorded in the index and the workspace history. target is
+// the folder name used when the command line has none; results makes the
+// scan write a results file for a later step to read (see Prepare).
+func prepareScan(ws *Workspace, o *OutputManager, scripts []NSEScript, name, cmdline, target string, built, results bool) (string, error) {
+	args, err := splitArgs(cmdline)
+	if err != nil {
+		return cmdline, err
+	}
+	if ws != nil {
+		if t, ok := ws.InScope(scanTargets(args)); !ok {
+			return cmdline, fmt.Errorf("target %s is outside the scope of workspace %s", t, ws.Name)
+		}
+		if err := ws.CheckScripts(args, scripts); err != nil {
+			return cmdline, err
+		}
+	}
+	target = commandTarget(args, target)
+	args, dir, err := o.Prepare(args, target, built, results)
+	if err != nil {
+		return cmdline, err
+	}
+	if dir != "" {
+		cmdline = joinArgs(args)
+		if err := o.Record(IndexEntry{Name: name, Target: target, Dir: dir, Cmd: cmdline}); err != nil {
+			return cmdline, err
+		}
+	}
+	if ws != nil {
+		_ = ws.AppendHistory(name, cmdline)
+	}
+	return cmdline, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepareResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		autoOA  bool
+		built   bool
+		results bool
+		cmd     string
+		want    string // DIR stands for the scan folder; "" means unchanged
+	}{
+		{"auto -oA", true, true, true, "nmap -sn 10.0.0.0/24", "nmap -oA DIR/scan -sn 10.0.0.0/24"},
+		{"no auto_oa", false, true, true, "nmap -sn 10.0.0.0/24", "nmap -sn 10.0.0.0/24 -oX DIR/scan.xml"},
+		{"custom command", true, false, true, "nmap -sn 10.0.0.0/24", "nmap -sn 10.0.0.0/24 -oX DIR/scan.xml"},
+		{"normal output only", true, true, true, "nmap -sn -oN /tmp/sweep.nmap 10.0.0.0/24", "nmap -sn -oN /tmp/sweep.nmap 10.0.0.0/24 -oX DIR/scan.xml"},
+		{"XML already written", false, true, true, "nmap -sn -oX /tmp/sweep.xml 10.0.0.0/24", ""},
+		{"-oA already written", false, false, true, "nmap -sn -oA /tmp/sweep 10.0.0.0/24", ""},
+		{"masscan", false, true, true, "masscan -p80 10.0.0.0/24", "masscan -p80 10.0.0.0/24 -oJ DIR/scan.json"},
+		{"results not needed", false, true, false, "nmap -sn 10.0.0.0/24", ""},
+		{"resume", false, true, true, "nmap --resume /tmp/sweep.gnmap", ""},
+	}
+	for _, tt := range tests {
+		o := newOutputManager(OutputConfig{Dir: t.TempDir(), AutoOA: tt.autoOA})
+		args, err := splitArgs(tt.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, dir, err := o.Prepare(args, "10.0.0.0/24", tt.built, tt.results)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := tt.cmd
+		if tt.want != "" {
+			if dir == "" {
+				t.Errorf("%s: no scan folder", tt.name)
+				continue
+			}
+			want = strings.ReplaceAll(tt.want, "DIR", filepath.ToSlash(dir))
+		}
+		if got := joinArgs(out); filepath.ToSlash(got) != want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, want)
+		}
+		if tt.results && !strings.Contains(tt.cmd, "--resume") && resultsPath(joinArgs(out)) == "" {
+			t.Errorf("%s: %q writes no results file", tt.name, joinArgs(out))
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ---------- scan pipelines ----------
+
+// Pipeline is a named sequence of nmap steps from the "pipelines" block of
+// config.json. Each step scans what an earlier step found.
+type Pipeline struct {
+	Name  string         `json:"name"`
+	Steps []PipelineStep `json:"steps"`
+}
+
+// PipelineStep is one nmap command of a pipeline, without "nmap" and the
+// targets, which come from an earlier step's results.
+type PipelineStep struct {
+	Name string `json:"name"`
+	Args string `json:"args"`
+	// From names the step whose results this one uses; default the previous one.
+	From string `json:"from,omitempty"`
+	// Targets: "input" (the pipeline target), "up" (hosts up in From, the
+	// default) or "open" (hosts with open ports in From).
+	Targets string `json:"targets,omitempty"`
+	// Ports: "open" adds -p with the ports found open in From; "" leaves
+	// the ports to Args.
+	Ports string `json:"ports,omitempty"`
+	// PerHost runs one job per target host instead of one for all.
+	PerHost bool `json:"per_host,omitempty"`
+}
+
+func defaultPipelines() []Pipeline {
+	return []Pipeline{{
+		Name: "Sweep, SYN, versions, UDP",
+		Steps: []PipelineStep{
+			{Name: "ping sweep", Args: "-sn", Targets: "input"},
+			{Name: "top-1000 SYN", Args: "-sS --top-ports 1000"},
+			{Name: "version+scripts", Args: "-sCV", Targets: "open", Ports: "open", PerHost: true},
+			{Name: "UDP top-50", Args: "-sU --top-ports 50", From: "ping sweep"},
+		},
+	}}
+}
+
+// Validate checks step references and options.
+func (p Pipeline) Validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline %q has no steps", p.Name)
+	}
+	seen := make(map[string]bool)
+	for i, s := range p.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("pipeline %q: step %d has no name", p.Name, i+1)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("pipeline %q: two steps named %q", p.Name, s.Name)
+		}
+		if s.From != "" && !seen[s.From] {
+			return fmt.Errorf("pipeline %q, step %q: from %q is not an earlier step", p.Name, s.Name, s.From)
+		}
+		switch s.Targets {
+		case "", "input", "up", "open":
+		default:
+			return fmt.Errorf("pipeline %q, step %q: targets must be input, up or open", p.Name, s.Name)
+		}
+		switch s.Ports {
+		case "", "open":
+		default:
+			return fmt.Errorf("pipeline %q, step %q: ports must be open or empty", p.Name, s.Name)
+		}
+		if i == 0 && (s.Targets == "up" || s.Targets == "open" || s.Ports == "open") {
+			return fmt.Errorf("pipeline %q: the first step has no earlier results to use", p.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// findPipeline returns the pipeline with the given name.
+func findPipeline(pipelines []Pipeline, name string) (Pipeline, bool) {
+	for _, p := range pipelines {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Pipeline{}, false
+}
+
+// StepState is the progress of one pipeline step.
+type StepState int
+
+const (
+	StepPending StepState = iota
+	StepRunning
+	StepDone
+	StepFailed
+	StepSkipped // nothing to scan
+)
+
+func (s StepState) String() string {
+	switch s {
+	case StepPending:
+		return "pending"
+	case StepRunning:
+		return "running"
+	case StepDone:
+		return "done"
+	case StepFailed:
+		return "failed"
+	case StepSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// StepStatus is what the UI shows for a step.
+type StepStatus struct {
+	State  StepState
+	Jobs   int // jobs queued for the step
+	Failed int // jobs that did not finish successfully
+	Hosts  int // hosts in the step's results
+	Err    error
+}
+
+// PipelineRun executes a pipeline one step at a time: a step's jobs are
+// queued when every job of the previous step has finished.
+type PipelineRun struct {
+	ID       int
+	Pipeline Pipeline
+	Target   string
+	// OnChange is called, outside the run's lock, whenever a step changes.
+	OnChange func(*PipelineRun)
+
+	// launch queues one job. It is called from the run's own goroutines,
+	// never from the UI goroutine, and without holding mu.
+	launch func(name, cmdline string, then JobOption) error
+
+	mu      sync.Mutex
+	steps   []StepStatus
+	results []*NmapRun // merged results of each finished step
+	pending []int      // jobs still running per step
+	jobs    [][]*Job   // finished jobs per step
+}
+
+func newPipelineRun(id int, p Pipeline, target string, launch func(name, cmdline string, then JobOption) error) (*PipelineRun, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(target) == "" {
+		return nil, fmt.Errorf("pipeline %q needs a target", p.Name)
+	}
+	n := len(p.Steps)
+	return &PipelineRun{
+		ID:       id,
+		Pipeline: p,
+		Target:   target,
+		launch:   launch,
+		steps:    make([]StepStatus, n),
+		results:  make([]*NmapRun, n),
+		pending:  make([]int, n),
+		jobs:     make([][]*Job, n),
+	}, nil
+}
+
+// Start queues the first step. Steps are started from their own goroutine,
+// so launch may block on the UI.
+func (r *PipelineRun) Start() {
+	go r.startStep(0)
+}
+
+// Steps returns a snapshot of the step states.
+func (r *PipelineRun) Steps() []StepStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StepStatus(nil), r.steps...)
+}
+
+// States returns the state of every step, for the Pipelines page.
+func (r *PipelineRun) States() []StepState {
+	var states []StepState
+	for _, s := range r.Steps() {
+		states = append(states, s.State)
+	}
+	return states
+}
+
+// Finished reports whether no step is pending or running.
+func (r *PipelineRun) Finished() bool {
+	for _, s := range r.Steps() {
+		if s.State == StepPending || s.State == StepRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// source returns the index of the step whose results step i uses.
+func (r *PipelineRun) source(i int) int {
+	from := r.Pipeline.Steps[i].From
+	for j := 0; j < i; j++ {
+		if r.Pipeline.Steps[j].Name == from {
+			return j
+		}
+	}
+	return i - 1
+}
+
+// stepCommands composes the commands of step i from earlier results.
+func (r *PipelineRun) stepCommands(i int) []string {
+	step := r.Pipeline.Steps[i]
+	base := "nmap " + step.Args
+	if i == 0 || step.Targets == "input" {
+		return []string{strings.Join(strings.Fields(base+" "+r.Target), " ")}
+	}
+
+	r.mu.Lock()
+	from := r.results[r.source(i)]
+	r.mu.Unlock()
+	if from == nil {
+		return nil
+	}
+	var hosts []Host
+	for _, h := range from.Hosts {
+		switch {
+		case h.Addr() == "":
+		case step.Targets == "open" && len(h.OpenPorts()) == 0:
+		case h.Status.State != "" && h.Status.State != "up":
+		default:
+			hosts = append(hosts, h)
+		}
+	}
+	if step.Ports == "open" {
+		// without any open port there is nothing to scan
+		var withPorts []Host
+		for _, h := range hosts {
+			if len(h.OpenPorts()) > 0 {
+				withPorts = append(withPorts, h)
+			}
+		}
+		hosts = withPorts
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	command := func(hs []Host) string {
+		cmd := base
+		if step.Ports == "open" {
+			var ports []Port
+			seen := make(map[string]bool)
+			for _, h := range hs {
+				for _, p := range h.OpenPorts() {
+					key := fmt.Sprintf("%d/%s", p.PortID, p.Protocol)
+					if !seen[key] {
+						seen[key] = true
+						ports = append(ports, p)
+					}
+				}
+			}
+			cmd += " -p " + portSpec(ports)
+		}
+		for _, h := range hs {
+			cmd += " " + h.Addr()
+		}
+		return strings.Join(strings.Fields(cmd), " ")
+	}
+	if !step.PerHost {
+		return []string{command(hosts)}
+	}
+	cmds := make([]string, len(hosts))
+	for k, h := range hosts {
+		cmds[k] = command([]Host{h})
+	}
+	return cmds
+}
+
+func (r *PipelineRun) startStep(i int) {
+	if i >= len(r.Pipeline.Steps) {
+		return
+	}
+	cmds := r.stepCommands(i)
+	r.mu.Lock()
+	if len(cmds) == 0 {
+		r.steps[i].State = StepSkipped
+	} else {
+		r.pending[i] = len(cmds)
+		r.steps[i].State = StepRunning
+		r.steps[i].Jobs = len(cmds)
+	}
+	r.mu.Unlock()
+	r.changed()
+	if len(cmds) == 0 {
+		r.startStep(i + 1)
+		return
+	}
+
+	step := r.Pipeline.Steps[i]
+	for k, cmd := range cmds {
+		name := r.Pipeline.Name + " › " + step.Name
+		if step.PerHost {
+			args := strings.Fields(cmd)
+			name += ": " + args[len(args)-1]
+		}
+		if err := r.launch(name, cmd, Then(func(j *Job) { r.jobDone(i, j) })); err != nil {
+			// jobs that were not queued will never finish
+			r.mu.Lock()
+			r.pending[i] -= len(cmds) - k
+			r.steps[i].Failed += len(cmds) - k
+			r.steps[i].Err = err
+			last := r.pending[i] == 0
+			r.mu.Unlock()
+			if last {
+				go r.finishStep(i)
+			}
+			return
+		}
+	}
+}
+
+// jobDone is the Then hook of every job of step i.
+func (r *PipelineRun) jobDone(i int, j *Job) {
+	r.mu.Lock()
+	r.jobs[i] = append(r.jobs[i], j)
+	r.pending[i]--
+	last := r.pending[i] == 0
+	r.mu.Unlock()
+	if last {
+		// may be running on the UI goroutine if the job could not start
+		go r.finishStep(i)
+	}
+}
+
+// finishStep merges the XML of the step's jobs and starts the next step.
+func (r *PipelineRun) finishStep(i int) {
+	r.mu.Lock()
+	jobs := r.jobs[i]
+	failed := r.steps[i].Failed
+	stepErr := r.steps[i].Err
+	r.mu.Unlock()
+
+	merged := &NmapRun{}
+	ok := 0
+	for _, j := range jobs {
+		run, err := sweepResults(j)
+		if err != nil {
+			failed++
+			stepErr = err
+			continue
+		}
+		ok++
+		merged.Hosts = append(merged.Hosts, run.Hosts...)
+	}
+	dedupeHosts(merged)
+	sort.SliceStable(merged.Hosts, func(a, b int) bool { return merged.Hosts[a].Addr() < merged.Hosts[b].Addr() })
+
+	r.mu.Lock()
+	r.results[i] = merged
+	r.steps[i].Failed = failed
+	r.steps[i].Err = stepErr
+	r.steps[i].Hosts = len(merged.Hosts)
+	if ok == 0 {
+		r.steps[i].State = StepFailed
+		// later steps cannot run without these results
+		for k := i + 1; k < len(r.steps); k++ {
+			r.steps[k].State = StepSkipped
+		}
+	} else {
+		r.steps[i].State = StepDone
+	}
+	r.mu.Unlock()
+	r.changed()
+	if ok > 0 {
+		r.startStep(i + 1)
+	}
+}
+
+func (r *PipelineRun) changed() {
+	if r.OnChange != nil {
+		r.OnChange(r)
+	}
+}
+
+// Status renders the run as lines of text, one per step.
+func (r *PipelineRun) Status() []string {
+	lines := []string{fmt.Sprintf("#%d %s on %s", r.ID, r.Pipeline.Name, r.Target)}
+	for i, s := range r.Steps() {
+		line := fmt.Sprintf("  %-8s %s", s.State, r.Pipeline.Steps[i].Name)
+		if s.Jobs > 0 {
+			line += fmt.Sprintf("  %d jobs", s.Jobs)
+		}
+		if s.State == StepDone || s.State == StepFailed {
+			line += fmt.Sprintf("  %d hosts", s.Hosts)
+		}
+		if s.Failed > 0 {
+			line += fmt.Sprintf("  %d failed", s.Failed)
+		}
+		if s.Err != nil {
+			line += "  " + s.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// validPipelines drops the pipelines that fail Validate and reports why.
+func validPipelines(ps []Pipeline) ([]Pipeline, []error) {
+	var ok []Pipeline
+	var errs []error
+	for _, p := range ps {
+		if err := p.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ok = append(ok, p)
+	}
+	return ok, errs
+}
+
+// Commands returns "nmap <args>" for each step, without targets: enough to
+// tell which NSE scripts the pipeline runs.
+func (p Pipeline) Commands() []string {
+	cmds := make([]string, len(p.Steps))
+	for i, s := range p.Steps {
+		cmds[i] = "nmap " + s.Args
+	}
+	return cmds
+}
+
+// Describe lists the steps of a pipeline, one per line.
+func (p Pipeline) Describe() string {
+	var b strings.Builder
+	for i, s := range p.Steps {
+		fmt.Fprintf(&b, "%d. %s: nmap %s", i+1, s.Name, s.Args)
+		if s.Ports == "open" {
+			b.WriteString(" -p <open ports>")
+		}
+		switch {
+		case i == 0 || s.Targets == "input":
+			b.WriteString(" <target>")
+		case s.Targets == "open":
+			b.WriteString(" <hosts with open ports>")
+		default:
+			b.WriteString(" <hosts up>")
+		}
+		if s.From != "" {
+			b.WriteString(" from " + s.From)
+		}
+		if s.PerHost {
+			b.WriteString(", one job per host")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Privileges describes what raw-socket scans the current user can run.
+type Privileges struct {
+	Root     bool // effective uid 0
+	NmapCaps bool // nmap has cap_net_raw via setcap, usable with --privileged
+	NmapPath string
+}
+
+// CanRaw reports whether SYN, UDP, ICMP and spoofing options will work
+// without sudo.
+func (p Privileges) CanRaw() bool {
+	return p.Root || p.NmapCaps
+}
+
+func (p Privileges) String() string {
+	switch {
+	case p.Root:
+		return "root"
+	case p.NmapCaps:
+		return "cap_net_raw"
+	}
+	return "unprivileged"
+}
+
+func detectPrivileges(nmapPath string) Privileges {
+	p := Privileges{Root: os.Geteuid() == 0, NmapPath: nmapPath}
+	if p.Root || nmapPath == "" {
+		return p
+	}
+	// getcap only exists on Linux; elsewhere this just reports no caps
+	if real, err := filepath.EvalSymlinks(nmapPath); err == nil {
+		nmapPath = real
+	}
+	out, err := execCommand("getcap", nmapPath).Output()
+	if err == nil && strings.Contains(string(out), "cap_net_raw") {
+		p.NmapCaps = true
+	}
+	return p
+}
+
+// rawFlags are the options that need raw sockets, by exact flag or prefix.
+var rawFlags = []string{
+	"-sS", "-sU", "-sA", "-sW", "-sM", "-sN", "-sF", "-sX", "-sY", "-sZ", "-sO", "-sI",
+	"-O", "-A", "-f", "--mtu", "-D", "-S", "--spoof-mac", "--badsum", "--ttl",
+	"-PE", "-PP", "-PM", "-PU", "-PY", "-PO", "-PR", "--traceroute",
+}
+
+// flagNeedsRoot reports whether a single option (as written in the option
+// lists, possibly with its value) needs raw sockets.
+func flagNeedsRoot(flag string) bool {
+	f := strings.Fields(flag)
+	if len(f) == 0 {
+		return false
+	}
+	for _, r := range rawFlags {
+		if f[0] == r || (len(r) == 3 && strings.HasPrefix(r, "-P") && strings.HasPrefix(f[0], r)) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsRoot reports whether an nmap command line uses any raw-socket option.
+// masscan always sends raw packets.
+func needsRoot(args []string) bool {
+	if len(args) > 0 && args[0] == "sudo" {
+		return false
+	}
+	if b, _ := commandBackend(args); b != nil && b.Name() == "masscan" {
+		return true
+	}
+	for _, a := range args {
+		if flagNeedsRoot(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// withPrivileged adds --privileged after nmap so a setcap'd binary uses
+// raw sockets instead of falling back to connect scans.
+func withPrivileged(args []string) []string {
+	for i, a := range args {
+		if a == "--privileged" {
+			return args
+		}
+		if filepath.Base(a) == "nmap" {
+			out := append([]string(nil), args[:i+1]...)
+			out = append(out, "--privileged")
+			return append(out, args[i+1:]...)
+		}
+	}
+	return args
+}
+
+// sudoArgs wraps a command for sudo. With a password sudo reads it from
+// stdin (-S) without printing a prompt; without one it must not ask (-n).
+func sudoArgs(args []string, withPassword bool) []string {
+	if withPassword {
+		return append([]string{"sudo", "-S", "-p", ""}, args...)
+	}
+	return append([]string{"sudo", "-n"}, args...)
+}
+
+// sudoCached reports whether sudo currently runs without asking for a password.
+func sudoCached() bool {
+	return execCommand("sudo", "-n", "true").Run() == nil
+}
+
+// rootLabel is the marker appended to options that need raw sockets.
+func rootLabel(p Privileges) string {
+	if p.CanRaw() {
+		return " [grey](root)[-]"
+	}
+	return " [red](root)[-]"
+}
+
+// privilegeHint explains in the detail pane how a command will get root.
+func privilegeHint(p Privileges) string {
+	if p.NmapCaps {
+		return "nmap has cap_net_raw: --privileged is added automatically"
+	}
+	return fmt.Sprintf("Running as %s: this command needs root for raw sockets", p)
+}
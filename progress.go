@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is the latest progress nmap reported for a running scan.
+type Progress struct {
+	Phase     string // e.g. "SYN Stealth Scan"
+	Percent   float64
+	ETC       string        // estimated clock time of completion, as printed by nmap
+	Remaining time.Duration // 0 when unknown
+	Elapsed   string
+	Known     bool // false until the first progress line is seen
+}
+
+var (
+	// SYN Stealth Scan Timing: About 12.34% done; ETC: 14:02 (0:01:25 remaining)
+	timingRe = regexp.MustCompile(`^(.+?) Timing: About ([\d.]+)% done(?:; ETC: (\S+) \(([\d:]+) remaining\))?`)
+	// Stats: 0:00:12 elapsed; 0 hosts completed (1 up), 1 undergoing SYN Stealth Scan
+	statsRe = regexp.MustCompile(`^Stats: ([\d:]+) elapsed;.* undergoing (.+)$`)
+	// <taskprogress task="SYN Stealth Scan" time="1700000000" percent="12.34" remaining="85" etc="1700000085"/>
+	taskProgressRe = regexp.MustCompile(`<taskprogress task="([^"]+)"[^>]* percent="([\d.]+)"(?:[^>]* remaining="(\d+)")?(?:[^>]* etc="(\d+)")?`)
+)
+
+// update applies one line of nmap output. It reports whether the line
+// carried progress information.
+func (p *Progress) update(line string) bool {
+	line = strings.TrimSpace(line)
+	if m := timingRe.FindStringSubmatch(line); m != nil {
+		p.Phase = m[1]
+		p.Percent, _ = strconv.ParseFloat(m[2], 64)
+		p.ETC = m[3]
+		p.Remaining = parseClock(m[4])
+		p.Known = true
+		return true
+	}
+	if m := statsRe.FindStringSubmatch(line); m != nil {
+		if m[2] != p.Phase {
+			// new phase: the previous percentage no longer applies
+			p.Percent, p.ETC, p.Remaining = 0, "", 0
+		}
+		p.Elapsed = m[1]
+		p.Phase = m[2]
+		p.Known = true
+		return true
+	}
+	if m := taskProgressRe.FindStringSubmatch(line); m != nil {
+		p.Phase = m[1]
+		p.Percent, _ = strconv.ParseFloat(m[2], 64)
+		if secs, err := strconv.Atoi(m[3]); err == nil {
+			p.Remaining = time.Duration(secs) * time.Second
+		}
+		if etc, err := strconv.ParseInt(m[4], 10, 64); err == nil {
+			p.ETC = time.Unix(etc, 0).Format("15:04")
+		}
+		p.Known = true
+		return true
+	}
+	return false
+}
+
+// parseClock parses nmap's h:mm:ss durations.
+func parseClock(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
+
+// String renders a one-line progress bar with percent, ETA and phase.
+func (p Progress) String() string {
+	if !p.Known {
+		return ""
+	}
+	s := fmt.Sprintf("%s %5.1f%%", progressBar(p.Percent, 20), p.Percent)
+	if p.Remaining > 0 {
+		s += fmt.Sprintf(" ETA %s", p.Remaining)
+	}
+	if p.ETC != "" {
+		s += fmt.Sprintf(" (%s)", p.ETC)
+	}
+	return s + " " + p.Phase
+}
+
+func progressBar(percent float64, width int) string {
+	full := int(percent / 100 * float64(width))
+	if full > width {
+		full = width
+	}
+	if full < 0 {
+		full = 0
+	}
+	return strings.Repeat("█", full) + strings.Repeat("░", width-full)
+}
+
+// injectStats adds --stats-every to an nmap command line so progress lines
+// are printed. Commands that already set it, use --resume (which accepts no
+// other options) or are not nmap are returned unchanged.
+func injectStats(args []string, every string) []string {
+	if every == "" {
+		return args
+	}
+	at := -1
+	for i, a := range args {
+		switch {
+		case a == "--stats-every" || strings.HasPrefix(a, "--stats-every=") || a == "--resume":
+			return args
+		case at < 0 && filepath.Base(a) == "nmap":
+			at = i
+		}
+	}
+	if at < 0 {
+		return args
+	}
+	out := append([]string(nil), args[:at+1]...)
+	out = append(out, "--stats-every", every)
+	return append(out, args[at+1:]...)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProgressUpdate(t *testing.T) {
+	etc := time.Unix(1700000085, 0).Format("15:04")
+	tests := []struct {
+		name  string
+		lines []string
+		want  Progress
+	}{
+		{
+			name:  "stats line",
+			lines: []string{"Stats: 0:00:12 elapsed; 0 hosts completed (1 up), 1 undergoing SYN Stealth Scan"},
+			want:  Progress{Phase: "SYN Stealth Scan", Elapsed: "0:00:12", Known: true},
+		},
+		{
+			name: "stats then timing",
+			lines: []string{
+				"Stats: 0:00:12 elapsed; 0 hosts completed (1 up), 1 undergoing SYN Stealth Scan",
+				"SYN Stealth Scan Timing: About 12.34% done; ETC: 14:02 (0:01:25 remaining)",
+			},
+			want: Progress{Phase: "SYN Stealth Scan", Percent: 12.34, ETC: "14:02", Remaining: 85 * time.Second, Elapsed: "0:00:12", Known: true},
+		},
+		{
+			name:  "timing before the first estimate",
+			lines: []string{"Connect Scan Timing: About 0.00% done"},
+			want:  Progress{Phase: "Connect Scan", Known: true},
+		},
+		{
+			name: "same phase keeps the percentage",
+			lines: []string{
+				"Service scan Timing: About 50.00% done; ETC: 14:05 (0:00:30 remaining)",
+				"Stats: 0:01:07 elapsed; 1 hosts completed (1 up), 1 undergoing Service scan",
+			},
+			want: Progress{Phase: "Service scan", Percent: 50, ETC: "14:05", Remaining: 30 * time.Second, Elapsed: "0:01:07", Known: true},
+		},
+		{
+			name: "new phase resets the percentage",
+			lines: []string{
+				"SYN Stealth Scan Timing: About 99.10% done; ETC: 14:02 (0:00:01 remaining)",
+				"Stats: 0:00:40 elapsed; 1 hosts completed (1 up), 1 undergoing Script Scan",
+			},
+			want: Progress{Phase: "Script Scan", Elapsed: "0:00:40", Known: true},
+		},
+		{
+			// after SIGSTOP/SIGCONT nmap's estimate jumps by the time spent paused
+			name: "ETA after pause and resume",
+			lines: []string{
+				"SYN Stealth Scan Timing: About 30.00% done; ETC: 14:10 (0:05:00 remaining)",
+				"Stats: 1:12:40 elapsed; 0 hosts completed (256 up), 256 undergoing SYN Stealth Scan",
+				"SYN Stealth Scan Timing: About 31.02% done; ETC: 15:22 (1:02:03 remaining)",
+			},
+			want: Progress{Phase: "SYN Stealth Scan", Percent: 31.02, ETC: "15:22", Remaining: time.Hour + 2*time.Minute + 3*time.Second, Elapsed: "1:12:40", Known: true},
+		},
+		{
+			name:  "XML taskprogress",
+			lines: []string{`<taskprogress task="SYN Stealth Scan" time="1700000000" percent="12.34" remaining="85" etc="1700000085"/>`},
+			want:  Progress{Phase: "SYN Stealth Scan", Percent: 12.34, ETC: etc, Remaining: 85 * time.Second, Known: true},
+		},
+		{
+			name:  "XML taskprogress without estimate",
+			lines: []string{`<taskprogress task="Ping Scan" time="1700000000" percent="0.00"/>`},
+			want:  Progress{Phase: "Ping Scan", Known: true},
+		},
+		{
+			name: "other lines are ignored",
+			lines: []string{
+				"Starting Nmap 7.94 ( https://nmap.org ) at 2024-01-01 14:00 CET",
+				"Nmap scan report for 192.168.1.1",
+				"22/tcp open  ssh",
+			},
+			want: Progress{},
+		},
+	}
+	for _, tt := range tests {
+		var p Progress
+		for _, line := range tt.lines {
+			p.update(line + "\r")
+		}
+		if !reflect.DeepEqual(p, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, p, tt.want)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"0:00:30", 30 * time.Second},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"12:00", 12 * time.Minute},
+		{"0:x:01", 0},
+	}
+	for _, tt := range tests {
+		if got := parseClock(tt.in); got != tt.want {
+			t.Errorf("parseClock(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInjectStats(t *testing.T) {
+	tests := []struct {
+		args  []string
+		every string
+		want  []string
+	}{
+		{[]string{"nmap", "-sS", "10.0.0.1"}, "5s", []string{"nmap", "--stats-every", "5s", "-sS", "10.0.0.1"}},
+		{[]string{"sudo", "-n", "/usr/bin/nmap", "-sS", "10.0.0.1"}, "5s", []string{"sudo", "-n", "/usr/bin/nmap", "--stats-every", "5s", "-sS", "10.0.0.1"}},
+		{[]string{"nmap", "-sS", "10.0.0.1"}, "", []string{"nmap", "-sS", "10.0.0.1"}},
+		{[]string{"nmap", "--stats-every", "1m", "10.0.0.1"}, "5s", []string{"nmap", "--stats-every", "1m", "10.0.0.1"}},
+		{[]string{"nmap", "--stats-every=1m", "10.0.0.1"}, "5s", []string{"nmap", "--stats-every=1m", "10.0.0.1"}},
+		{[]string{"nmap", "--resume", "scan.gnmap"}, "5s", []string{"nmap", "--resume", "scan.gnmap"}},
+		{[]string{"masscan", "-p80", "10.0.0.0/24"}, "5s", []string{"masscan", "-p80", "10.0.0.0/24"}},
+	}
+	for _, tt := range tests {
+		if got := injectStats(tt.args, tt.every); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("injectStats(%q, %q) = %q, want %q", tt.args, tt.every, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RedactConfig selects what is replaced before text is sent to the AI provider.
+type RedactConfig struct {
+	Enabled   bool     `json:"enabled"`
+	IPs       bool     `json:"ips"`
+	CIDRs     bool     `json:"cidrs"`
+	Hostnames bool     `json:"hostnames"` // names with three or more labels (db.acme.com)
+	Domains   bool     `json:"domains"`   // two-label names (acme.com)
+	Terms     []string `json:"terms"`     // extra literals, e.g. the client's name
+	Keep      []string `json:"keep"`      // values never redacted
+}
+
+func defaultRedactConfig() RedactConfig {
+	return RedactConfig{
+		Enabled:   true,
+		IPs:       true,
+		CIDRs:     true,
+		Hostnames: true,
+		Domains:   true,
+		Keep:      []string{"localhost", "nmap.org"},
+	}
+}
+
+// candidatos: CIDR, IPv4, IPv6 y nombres con puntos
+var redactRe = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?:/\d{1,2})?\b` +
+	`|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:/\d{1,3})?` +
+	`|\b(?:[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+[A-Za-z]{2,63}\b`)
+
+var placeholderRe = regexp.MustCompile(`\b(?:IP|NET|HOST|DOMAIN|TERM)_\d+\b`)
+
+// Suffixes that look like a TLD but are file names or software in nmap output.
+var notTLD = map[string]bool{
+	"xml": true, "nmap": true, "gnmap": true, "txt": true, "nse": true, "lua": true,
+	"json": true, "html": true, "htm": true, "csv": true, "log": true, "md": true,
+	"js": true, "php": true, "asp": true, "aspx": true, "jsp": true, "cgi": true,
+	"conf": true, "db": true, "exe": true, "dll": true, "so": true, "py": true,
+}
+
+// genericTLDs are the suffixes besides two-letter country codes that make
+// a dotted word a name. Software names such as Microsoft.Windows end in
+// anything else; internal suffixes (local, corp …) are listed because
+// engagements use them. Other names can go in Terms.
+var genericTLDs = map[string]bool{
+	"com": true, "net": true, "org": true, "edu": true, "gov": true, "mil": true, "int": true,
+	"arpa": true, "info": true, "biz": true, "name": true, "pro": true, "io": true, "dev": true,
+	"app": true, "cloud": true, "online": true, "site": true, "tech": true, "xyz": true,
+	"local": true, "lan": true, "corp": true, "internal": true, "intranet": true, "home": true,
+	"localdomain": true, "private": true, "domain": true, "test": true, "example": true,
+}
+
+// isTLD reports whether label can end a host or domain name.
+func isTLD(label string) bool {
+	label = strings.ToLower(label)
+	if notTLD[label] {
+		return false
+	}
+	if len(label) == 2 {
+		return true
+	}
+	return genericTLDs[label]
+}
+
+// Redactor swaps sensitive values for stable placeholders (IP_1, HOST_2 …)
+// and maps them back. The same value always gets the same placeholder for
+// the lifetime of the Redactor.
+type Redactor struct {
+	cfg   RedactConfig
+	keep  map[string]bool
+	terms []redactTerm
+
+	mu     sync.Mutex
+	toPH   map[string]string
+	fromPH map[string]string
+	counts map[string]int
+}
+
+// redactTerm is a literal to redact and its pattern, compiled once.
+type redactTerm struct {
+	text string
+	re   *regexp.Regexp
+}
+
+func newRedactor(cfg RedactConfig) *Redactor {
+	r := &Redactor{}
+	r.Reset(cfg)
+	return r
+}
+
+// Reset switches to new rules and forgets all placeholders, e.g. when
+// changing workspace.
+func (r *Redactor) Reset(cfg RedactConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+	r.keep = make(map[string]bool)
+	for _, k := range cfg.Keep {
+		r.keep[strings.ToLower(k)] = true
+	}
+	r.terms = nil
+	for _, t := range cfg.Terms {
+		r.addTerm(t)
+	}
+	r.toPH = make(map[string]string)
+	r.fromPH = make(map[string]string)
+	r.counts = make(map[string]int)
+}
+
+// AddTerm registers a literal to redact, such as a single-label hostname
+// taken from scan results that the patterns would not catch.
+func (r *Redactor) AddTerm(term string) {
+	if r == nil || term == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addTerm(term)
+}
+
+// addTerm compiles the pattern of a new term. Caller holds r.mu.
+func (r *Redactor) addTerm(term string) {
+	if term == "" || r.keep[strings.ToLower(term)] {
+		return
+	}
+	for _, t := range r.terms {
+		if t.text == term {
+			return
+		}
+	}
+	r.terms = append(r.terms, redactTerm{term, regexp.MustCompile(`\b` + regexp.QuoteMeta(term) + `\b`)})
+}
+
+// AddTargets registers the targets of a scan command that the patterns
+// would not catch: single-label names such as "dc01".
+func (r *Redactor) AddTargets(cmd string) {
+	args, err := splitArgs(cmd)
+	if err != nil {
+		return
+	}
+	for _, t := range scanTargets(args) {
+		if !strings.ContainsAny(t, ".:/") {
+			r.AddTerm(t)
+		}
+	}
+}
+
+// Redact replaces every configured kind of value in s.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cfg.Enabled {
+		return s
+	}
+
+	s = redactRe.ReplaceAllStringFunc(s, func(m string) string {
+		if r.keep[strings.ToLower(m)] {
+			return m
+		}
+		if kind := r.classify(m); kind != "" {
+			return r.placeholder(kind, m)
+		}
+		return m
+	})
+	for _, t := range r.terms {
+		if !strings.Contains(s, t.text) {
+			continue
+		}
+		s = t.re.ReplaceAllString(s, r.placeholder("TERM", t.text))
+	}
+	return s
+}
+
+// Restore puts the original values back into a response.
+func (r *Redactor) Restore(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return placeholderRe.ReplaceAllStringFunc(s, func(ph string) string {
+		if orig, ok := r.fromPH[ph]; ok {
+			return orig
+		}
+		return ph
+	})
+}
+
+// classify returns the placeholder kind for a regex match, or "" to leave it alone.
+func (r *Redactor) classify(m string) string {
+	if strings.Contains(m, "/") {
+		if _, _, err := net.ParseCIDR(m); err == nil && r.cfg.CIDRs {
+			return "NET"
+		}
+		return ""
+	}
+	if net.ParseIP(m) != nil {
+		if r.cfg.IPs {
+			return "IP"
+		}
+		return ""
+	}
+	if strings.Contains(m, ":") {
+		return "" // not a valid IPv6 address (MACs, fingerprints, times)
+	}
+	labels := strings.Split(m, ".")
+	if !isTLD(labels[len(labels)-1]) {
+		return ""
+	}
+	if len(labels) == 2 {
+		if r.cfg.Domains {
+			return "DOMAIN"
+		}
+		return ""
+	}
+	if r.cfg.Hostnames {
+		return "HOST"
+	}
+	return ""
+}
+
+// placeholder returns the stable placeholder for value. Caller holds r.mu.
+func (r *Redactor) placeholder(kind, value string) string {
+	if ph, ok := r.toPH[value]; ok {
+		return ph
+	}
+	r.counts[kind]++
+	ph := fmt.Sprintf("%s_%d", kind, r.counts[kind])
+	r.toPH[value] = ph
+	r.fromPH[ph] = value
+	return ph
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*RedactConfig)
+		in   string
+		want string
+	}{
+		{"ipv4", nil, "host 10.0.0.5 is up", "host IP_1 is up"},
+		{"same value same placeholder", nil, "10.0.0.5 and 10.0.0.6 and 10.0.0.5", "IP_1 and IP_2 and IP_1"},
+		{"cidr", nil, "nmap 192.168.1.0/24", "nmap NET_1"},
+		{"ipv6", nil, "fe80::1 answered", "IP_1 answered"},
+		{"hostname", nil, "db.acme.com open", "HOST_1 open"},
+		{"domain", nil, "realm acme.com", "realm DOMAIN_1"},
+		{"internal suffix", nil, "dc01.corp.local", "HOST_1"},
+		{"file names", nil, "-oA scan.xml out.nmap", "-oA scan.xml out.nmap"},
+		{"software names", nil, "OS: Microsoft.Windows 10", "OS: Microsoft.Windows 10"},
+		{"mac address", nil, "MAC 00:0c:29:aa:bb:cc", "MAC 00:0c:29:aa:bb:cc"},
+		{"keep", nil, "see nmap.org and localhost", "see nmap.org and localhost"},
+		{"terms", func(c *RedactConfig) { c.Terms = []string{"Acme"} }, "Acme VPN", "TERM_1 VPN"},
+		{"ips off", func(c *RedactConfig) { c.IPs = false }, "10.0.0.5 db.acme.com", "10.0.0.5 HOST_1"},
+		{"domains off", func(c *RedactConfig) { c.Domains = false }, "acme.com db.acme.com", "acme.com HOST_1"},
+		{"disabled", func(c *RedactConfig) { c.Enabled = false }, "10.0.0.5", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultRedactConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			if got := newRedactor(cfg).Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactCommandTargets(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"nmap -sV dc01", "nmap -sV TERM_1"},
+		{"nmap -p 22,445 dc01 fs02", "nmap -p 22,445 TERM_1 TERM_2"},
+		{"nmap -sV dc01.acme.local", "nmap -sV HOST_1"},
+		{"nmap -T4 10.0.0.0/24", "nmap -T4 NET_1"},
+	}
+	for _, tt := range tests {
+		r := newRedactor(defaultRedactConfig())
+		r.AddTargets(tt.cmd)
+		if got := r.Redact(tt.cmd); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	r := newRedactor(defaultRedactConfig())
+	r.AddTerm("dc01")
+	in := "dc01 at 10.0.0.5 serves db.acme.com in 10.0.0.0/8"
+	red := r.Redact(in)
+	for _, secret := range []string{"dc01", "10.0.0.5", "acme", "10.0.0.0"} {
+		if strings.Contains(red, secret) {
+			t.Fatalf("Redact left %q in %q", secret, red)
+		}
+	}
+	if got := r.Restore(red); got != in {
+		t.Errorf("Restore(%q) = %q, want %q", red, got, in)
+	}
+	// placeholders the Redactor never handed out stay as they are
+	if got := r.Restore("IP_9 and HOST_1"); got != "IP_9 and db.acme.com" {
+		t.Errorf("Restore = %q", got)
+	}
+	// Reset forgets the mapping
+	r.Reset(defaultRedactConfig())
+	if got := r.Restore("IP_1"); got != "IP_1" {
+		t.Errorf("Restore after Reset = %q, want IP_1", got)
+	}
+}
+
+func TestRedactConcurrentReset(t *testing.T) {
+	r := newRedactor(defaultRedactConfig())
+	off := defaultRedactConfig()
+	off.Enabled = false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			// a workspace switch while an explain request is in flight
+			if i%2 == 0 {
+				r.Reset(off)
+			} else {
+				r.Reset(defaultRedactConfig())
+			}
+			r.AddTerm("dc01")
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		out := r.Redact("dc01 at 10.0.0.5")
+		if out != "dc01 at 10.0.0.5" && !strings.Contains(out, "IP_1") {
+			t.Fatalf("Redact = %q", out)
+		}
+	}
+	<-done
+}
+
+func TestRedactTermsFromConfig(t *testing.T) {
+	cfg := defaultRedactConfig()
+	cfg.Terms = []string{"Acme", "", "Acme", "localhost"}
+	r := newRedactor(cfg)
+	if got := r.Redact("Acme VPN on localhost, not AcmeCorp"); got != "TERM_1 VPN on localhost, not AcmeCorp" {
+		t.Errorf("Redact = %q", got)
+	}
+	r.AddTerm("fs02")
+	r.Reset(cfg) // forgets added terms, keeps configured ones
+	if got := r.Redact("fs02 Acme"); got != "fs02 TERM_1" {
+		t.Errorf("after Reset: %q", got)
+	}
+}
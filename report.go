@@ -0,0 +1,221 @@
+package main
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ---------- reports ----------
+
+//go:embed templates/report.md.tmpl templates/report.html.tmpl
+var reportTemplates embed.FS
+
+// reportFormats maps a format to its file extension.
+var reportFormats = map[string]string{"md": ".md", "html": ".html", "csv": ".csv", "json": ".json"}
+
+// Report is what report templates are executed with.
+type Report struct {
+	Title     string       `json:"title"`
+	Generated time.Time    `json:"generated"`
+	Hosts     []HostRecord `json:"hosts"`
+	OpenPorts int          `json:"open_ports"`
+}
+
+// newReport keeps the ports of each host that match q. Hosts without
+// matching ports are dropped when q asks for particular ports or services.
+func newReport(title string, hosts []HostRecord, q Query) Report {
+	r := Report{Title: title, Generated: time.Now()}
+	for _, h := range hosts {
+		var ports []PortRecord
+		for _, p := range h.Ports {
+			if q.matchPort(p) {
+				ports = append(ports, p)
+				if p.State == "open" {
+					r.OpenPorts++
+				}
+			}
+		}
+		if len(ports) == 0 && (len(q.Ports) > 0 || q.Service != "") {
+			continue
+		}
+		h.Ports = ports
+		r.Hosts = append(r.Hosts, h)
+	}
+	return r
+}
+
+// reportFormat picks the format from an explicit name or the output file's
+// extension, defaulting to Markdown.
+func reportFormat(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+		if _, ok := reportFormats[format]; !ok {
+			format = "md"
+		}
+	}
+	if _, ok := reportFormats[format]; !ok {
+		return "", fmt.Errorf("unknown report format %q (md, html, csv or json)", format)
+	}
+	return format, nil
+}
+
+// writeReport renders r in one of the reportFormats.
+func writeReport(w io.Writer, format string, r Report) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "csv":
+		return writeReportCSV(w, r)
+	case "md":
+		t, err := reportTemplate(format, func(name, text string) (executor, error) {
+			return template.New(name).Funcs(template.FuncMap(reportFuncs)).Parse(text)
+		})
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, r)
+	case "html":
+		t, err := reportTemplate(format, func(name, text string) (executor, error) {
+			return htmltemplate.New(name).Funcs(htmltemplate.FuncMap(reportFuncs)).Parse(text)
+		})
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, r)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// executor is the part of text/template and html/template that reports use.
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// reportTemplate loads report.<format>.tmpl from <config dir>/templates if
+// it exists, or the built-in one.
+func reportTemplate(format string, parse func(name, text string) (executor, error)) (executor, error) {
+	name := "report." + format + ".tmpl"
+	custom := filepath.Join(configDir(), "templates", name)
+	text, err := os.ReadFile(custom)
+	if os.IsNotExist(err) {
+		text, err = reportTemplates.ReadFile("templates/" + name)
+		custom = ""
+	}
+	if err != nil {
+		return nil, err
+	}
+	t, err := parse(name, string(text))
+	if err != nil && custom != "" {
+		return nil, fmt.Errorf("%s: %w", custom, err)
+	}
+	return t, err
+}
+
+var anchorRe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// reportFuncs are available in report templates.
+var reportFuncs = map[string]interface{}{
+	"join": strings.Join,
+	"trim": strings.TrimSpace,
+	// version is product and version as one string
+	"version": func(p PortRecord) string {
+		return strings.TrimSpace(p.Product + " " + p.Version)
+	},
+	// openPorts lists a host's open ports, e.g. "22/tcp, 80/tcp"
+	"openPorts": func(h HostRecord) string {
+		var open []string
+		for _, p := range h.Ports {
+			if p.State == "open" {
+				open = append(open, fmt.Sprintf("%d/%s", p.Port, p.Proto))
+			}
+		}
+		return strings.Join(open, ", ")
+	},
+	// cell makes text safe inside a Markdown table cell
+	"cell": func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+	},
+	// anchor is an HTML id for an address; with the record's index it is
+	// unique even when a host was scanned more than once
+	"anchor": func(s string, index ...int) string {
+		id := "host-" + anchorRe.ReplaceAllString(s, "-")
+		for _, i := range index {
+			id += "-" + strconv.Itoa(i+1)
+		}
+		return id
+	},
+}
+
+// writeReportCSV writes one row per port; hosts without ports get one row.
+func writeReportCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"host", "hostname", "status", "port", "proto", "state", "service", "version", "scripts", "time", "source"})
+	for _, h := range r.Hosts {
+		base := []string{h.Addr, strings.Join(h.Hostnames, " "), h.Status}
+		tail := []string{h.Time.Format(time.RFC3339), h.Source}
+		if len(h.Ports) == 0 {
+			cw.Write(append(append(base, "", "", "", "", "", ""), tail...))
+			continue
+		}
+		for _, p := range h.Ports {
+			var ids []string
+			for _, s := range p.Scripts {
+				ids = append(ids, s.ID)
+			}
+			row := append(append([]string(nil), base...),
+				strconv.Itoa(p.Port), p.Proto, p.State, p.Service,
+				strings.TrimSpace(p.Product+" "+p.Version), strings.Join(ids, " "))
+			cw.Write(append(row, tail...))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// hostsFromRuns turns parsed scans into host records, as stored in the
+// results database.
+func hostsFromRuns(runs []*NmapRun, sources []string) []HostRecord {
+	var hosts []HostRecord
+	for i, run := range runs {
+		when := time.Now()
+		if run.Start > 0 {
+			when = time.Unix(run.Start, 0)
+		}
+		for _, h := range run.Hosts {
+			if rec := hostRecord(h, when, sources[i]); rec.Addr != "" {
+				hosts = append(hosts, rec)
+			}
+		}
+	}
+	return hosts
+}
+
+// saveReport writes a report file, choosing the format as reportFormat does.
+func saveReport(path, format string, r Report) error {
+	format, err := reportFormat(format, path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeReport(f, format, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
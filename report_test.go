@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testReport is a sweep and a later deep scan of 10.0.4.12, so the host
+// has two records.
+func testReport() Report {
+	host := func(addr, name string, ports ...Port) Host {
+		h := newImportedHost(addr, name)
+		h.Status.State = "up"
+		h.Ports = ports
+		return h
+	}
+	ssh := Port{Protocol: "tcp", PortID: 22, State: PortState{State: "open"},
+		Service: Service{Name: "ssh", Product: "OpenSSH", Version: "8.9p1"},
+		Scripts: []Script{{ID: "ssh-hostkey", Output: "\n  256 aa:bb (ED25519)"}}}
+	http := Port{Protocol: "tcp", PortID: 80, State: PortState{State: "closed"}, Service: Service{Name: "http"}}
+	https := Port{Protocol: "tcp", PortID: 443, State: PortState{State: "open"}, Service: Service{Name: "https", Product: "nginx"}}
+	deep := host("10.0.4.12", "web.acme.local", https)
+	deep.HostScripts = []Script{{ID: "smb-os-discovery", Output: "OS: Windows"}}
+	runs := []*NmapRun{
+		{Start: 1714831628, Hosts: []Host{host("10.0.4.12", "web.acme.local", ssh, http), host("10.0.4.20", "")}},
+		{Start: 1714832000, Hosts: []Host{deep}},
+	}
+	hosts := hostsFromRuns(runs, []string{"sweep.xml", "deep.xml"})
+	for i := range hosts {
+		hosts[i].Time = hosts[i].Time.UTC() // as JSON brings it back
+	}
+	r := newReport("Acme | 2025", hosts, Query{})
+	r.Generated = time.Date(2025, 5, 4, 14, 7, 9, 0, time.UTC)
+	return r
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Setenv("NMAPX_CONFIG_DIR", t.TempDir()) // the built-in templates
+	r := testReport()
+	out := make(map[string]string)
+	for format := range reportFormats {
+		var b bytes.Buffer
+		if err := writeReport(&b, format, r); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		out[format] = b.String()
+	}
+
+	// csv: one row per port, one for a host without ports
+	rows, err := csv.NewReader(strings.NewReader(out["csv"])).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"host", "hostname", "status", "port", "proto", "state", "service", "version", "scripts", "time", "source"},
+		{"10.0.4.12", "web.acme.local", "up", "22", "tcp", "open", "ssh", "OpenSSH 8.9p1", "ssh-hostkey", "2024-05-04T14:07:08Z", "sweep.xml"},
+		{"10.0.4.12", "web.acme.local", "up", "80", "tcp", "closed", "http", "", "", "2024-05-04T14:07:08Z", "sweep.xml"},
+		{"10.0.4.20", "", "up", "", "", "", "", "", "", "2024-05-04T14:07:08Z", "sweep.xml"},
+		{"10.0.4.12", "web.acme.local", "up", "443", "tcp", "open", "https", "nginx", "", "2024-05-04T14:13:20Z", "deep.xml"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("csv rows:\n%q\nwant\n%q", rows, want)
+	}
+
+	// json: decodes back to the same report
+	var back Report
+	if err := json.Unmarshal([]byte(out["json"]), &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, r) {
+		t.Errorf("json round trip:\n%+v\nwant\n%+v", back, r)
+	}
+
+	// html: every id unique and every summary link points at one
+	ids := make(map[string]bool)
+	for _, m := range regexp.MustCompile(`id="([^"]+)"`).FindAllStringSubmatch(out["html"], -1) {
+		if ids[m[1]] {
+			t.Errorf("html: duplicate id %q", m[1])
+		}
+		ids[m[1]] = true
+	}
+	links := regexp.MustCompile(`href="#([^"]+)"`).FindAllStringSubmatch(out["html"], -1)
+	if len(links) != len(r.Hosts) {
+		t.Errorf("html: %d host links, want %d", len(links), len(r.Hosts))
+	}
+	for _, m := range links {
+		if !ids[m[1]] {
+			t.Errorf("html: link to missing id %q", m[1])
+		}
+	}
+	for _, s := range []string{"<title>Acme | 2025</title>", "OpenSSH 8.9p1", "Host script smb-os-discovery", "3 hosts, 2 open ports"} {
+		if !strings.Contains(out["html"], s) {
+			t.Errorf("html: no %q", s)
+		}
+	}
+
+	// md: table cells escaped, a section per record
+	for _, s := range []string{"# Acme | 2025", "| 10.0.4.12 | web.acme.local | 22/tcp |", "| 443/tcp | open | https | nginx |", "**Host script smb-os-discovery**"} {
+		if !strings.Contains(out["md"], s) {
+			t.Errorf("md: no %q", s)
+		}
+	}
+	if n := strings.Count(out["md"], "\n## 10.0.4.12 (web.acme.local)\n"); n != 2 {
+		t.Errorf("md: %d sections for 10.0.4.12, want 2", n)
+	}
+}
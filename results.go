@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------- nmap XML output (-oX) ----------
+
+type NmapRun struct {
+	XMLName          xml.Name   `xml:"nmaprun"`
+	Scanner          string     `xml:"scanner,attr,omitempty"`
+	Args             string     `xml:"args,attr"`
+	Start            int64      `xml:"start,attr"`
+	Version          string     `xml:"version,attr,omitempty"`
+	XMLOutputVersion string     `xml:"xmloutputversion,attr,omitempty"`
+	ScanInfo         []ScanInfo `xml:"scaninfo"`
+	Hosts            []Host     `xml:"host"`
+	RunStats         *RunStats  `xml:"runstats"`
+}
+
+type ScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type RunStats struct {
+	Finished struct {
+		Time    int64   `xml:"time,attr"`
+		TimeStr string  `xml:"timestr,attr,omitempty"`
+		Elapsed float64 `xml:"elapsed,attr"`
+		Summary string  `xml:"summary,attr,omitempty"`
+		Exit    string  `xml:"exit,attr,omitempty"`
+	} `xml:"finished"`
+	Hosts struct {
+		Up    int `xml:"up,attr"`
+		Down  int `xml:"down,attr"`
+		Total int `xml:"total,attr"`
+	} `xml:"hosts"`
+}
+
+type Host struct {
+	StartTime  int64        `xml:"starttime,attr,omitempty"`
+	EndTime    int64        `xml:"endtime,attr,omitempty"`
+	Status     Status       `xml:"status"`
+	Addresses  []Address    `xml:"address"`
+	Hostnames  []Hostname   `xml:"hostnames>hostname"`
+	ExtraPorts []ExtraPorts `xml:"ports>extraports"`
+	Ports      []Port       `xml:"ports>port"`
+	// Other son los elementos que NmapX no usa (os, uptime, trace, times...),
+	// guardados tal cual para volver a escribirlos.
+	Other       []rawElement `xml:",any"`
+	HostScripts []Script     `xml:"hostscript>script"`
+}
+
+// ExtraPorts counts the ports in one state that nmap did not list one by
+// one, e.g. 997 closed.
+type ExtraPorts struct {
+	State   string       `xml:"state,attr"`
+	Count   int          `xml:"count,attr"`
+	Reasons []rawElement `xml:",any"` // <extrareasons>
+}
+
+// MarshalXML writes a host's children in the order of nmap's DTD:
+// <extraports> before <port> inside <ports>, <hostscript> only when
+// there are host scripts and before <trace>, and <times> last.
+func (h Host) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type ports struct {
+		Extra []ExtraPorts `xml:"extraports"`
+		Ports []Port       `xml:"port"`
+	}
+	type hostScript struct {
+		Scripts []Script `xml:"script"`
+	}
+	out := struct {
+		StartTime  int64        `xml:"starttime,attr,omitempty"`
+		EndTime    int64        `xml:"endtime,attr,omitempty"`
+		Status     Status       `xml:"status"`
+		Addresses  []Address    `xml:"address"`
+		Hostnames  []Hostname   `xml:"hostnames>hostname"`
+		Ports      *ports       `xml:"ports"`
+		Other      []rawElement `xml:",any"`
+		HostScript *hostScript  `xml:"hostscript"`
+		Trace      []rawElement `xml:",any"`
+		Times      []rawElement `xml:",any"`
+	}{StartTime: h.StartTime, EndTime: h.EndTime, Status: h.Status, Addresses: h.Addresses, Hostnames: h.Hostnames}
+	if len(h.ExtraPorts) > 0 || len(h.Ports) > 0 {
+		out.Ports = &ports{h.ExtraPorts, h.Ports}
+	}
+	for _, el := range h.Other {
+		switch el.XMLName.Local {
+		case "trace":
+			out.Trace = append(out.Trace, el)
+		case "times":
+			out.Times = append(out.Times, el)
+		default:
+			out.Other = append(out.Other, el)
+		}
+	}
+	if len(h.HostScripts) > 0 {
+		out.HostScript = &hostScript{h.HostScripts}
+	}
+	return e.EncodeElement(out, start)
+}
+
+// rawElement is an XML element kept as read.
+type rawElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+type Status struct {
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr,omitempty"`
+	ReasonTTL string `xml:"reason_ttl,attr,omitempty"`
+}
+
+type Address struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type Hostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type Port struct {
+	Protocol string    `xml:"protocol,attr"`
+	PortID   int       `xml:"portid,attr"`
+	State    PortState `xml:"state"`
+	Service  Service   `xml:"service"`
+	Scripts  []Script  `xml:"script"`
+}
+
+type PortState struct {
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr,omitempty"`
+	ReasonTTL string `xml:"reason_ttl,attr,omitempty"`
+}
+
+type Service struct {
+	Name      string   `xml:"name,attr,omitempty"`
+	Product   string   `xml:"product,attr,omitempty"`
+	Version   string   `xml:"version,attr,omitempty"`
+	ExtraInfo string   `xml:"extrainfo,attr,omitempty"`
+	OSType    string   `xml:"ostype,attr,omitempty"`
+	Tunnel    string   `xml:"tunnel,attr,omitempty"`
+	Method    string   `xml:"method,attr,omitempty"`
+	Conf      string   `xml:"conf,attr,omitempty"`
+	CPE       []string `xml:"cpe"`
+}
+
+type Script struct {
+	ID     string `xml:"id,attr" json:"id"`
+	Output string `xml:"output,attr" json:"output"`
+	// Data is the structured output (<elem>, <table>) as written by nmap.
+	Data string `xml:",innerxml" json:"-"`
+}
+
+//-------------------------------------------
+
+// parseNmapXML lee un archivo generado con -oX
+func parseNmapXML(path string) (*NmapRun, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run NmapRun
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &run, nil
+}
+
+// writeNmapXML guarda run como XML de nmap, legible por parseNmapXML y
+// por las herramientas que leen -oX.
+func writeNmapXML(path string, run *NmapRun) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encodeNmapXML(f, run); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encodeNmapXML(w io.Writer, run *NmapRun) error {
+	data, err := xml.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(append([]byte(xml.Header), data...), '\n'))
+	return err
+}
+
+// Addr returns the host's IP address, or the first address of any kind.
+func (h Host) Addr() string {
+	for _, a := range h.Addresses {
+		if a.AddrType == "ipv4" || a.AddrType == "ipv6" {
+			return a.Addr
+		}
+	}
+	if len(h.Addresses) > 0 {
+		return h.Addresses[0].Addr
+	}
+	return ""
+}
+
+// OpenPorts returns the ports nmap reported as open.
+func (h Host) OpenPorts() []Port {
+	var open []Port
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			open = append(open, p)
+		}
+	}
+	return open
+}
+
+// SummaryOptions controls how much detail summarizeResults keeps.
+type SummaryOptions struct {
+	MaxScriptOutput int // characters kept per script output, 0 = no limit
+}
+
+// summarizeResults condenses a run into a short text listing each live host
+// with its open ports, service versions and script findings.
+func summarizeResults(run *NmapRun, opts SummaryOptions) string {
+	var b strings.Builder
+	n := 0
+	for _, h := range run.Hosts {
+		if h.Status.State != "" && h.Status.State != "up" {
+			continue
+		}
+		n++
+		name := h.Addr()
+		if len(h.Hostnames) > 0 {
+			name += " (" + h.Hostnames[0].Name + ")"
+		}
+		fmt.Fprintf(&b, "%s\n", name)
+
+		open := h.OpenPorts()
+		if len(open) == 0 {
+			b.WriteString("  no open ports\n")
+		}
+		for _, p := range open {
+			svc := strings.TrimSpace(strings.Join([]string{p.Service.Name, p.Service.Product, p.Service.Version, p.Service.ExtraInfo}, " "))
+			fmt.Fprintf(&b, "  %d/%s %s\n", p.PortID, p.Protocol, svc)
+			for _, s := range p.Scripts {
+				fmt.Fprintf(&b, "    %s: %s\n", s.ID, condense(s.Output, opts.MaxScriptOutput))
+			}
+		}
+		for _, s := range h.HostScripts {
+			fmt.Fprintf(&b, "  [host] %s: %s\n", s.ID, condense(s.Output, opts.MaxScriptOutput))
+		}
+	}
+	if n == 0 {
+		return "No live hosts in results"
+	}
+	return b.String()
+}
+
+// condense collapses whitespace in script output and truncates it to max
+// bytes, without cutting a character in two.
+func condense(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if max > 0 && len(s) > max {
+		for max > 0 && !utf8.RuneStart(s[max]) {
+			max--
+		}
+		s = s[:max] + "…"
+	}
+	return s
+}
+
+// outputXMLPath returns the XML file a command writes via -oX or -oA, or "".
+func outputXMLPath(cmd string) string {
+	f, err := splitArgs(cmd) // quoted paths may have spaces
+	if err != nil {
+		return ""
+	}
+	for i := 0; i < len(f)-1; i++ {
+		switch f[i] {
+		case "-oX":
+			return f[i+1]
+		case "-oA":
+			return f[i+1] + ".xml"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCondense(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"  a\n\tb  c ", 0, "a b c"},
+		{"abcdef", 3, "abc…"},
+		{"abc", 3, "abc"},
+		{"Versión española", 6, "Versi…"}, // ó takes bytes 5-6
+		{"Versión española", 7, "Versió…"},
+		{"Ωmega", 1, "…"},
+		{"名前解決", 4, "名…"},
+	}
+	for _, tt := range tests {
+		got := condense(tt.in, tt.max)
+		if got != tt.want {
+			t.Errorf("condense(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("condense(%q, %d) is not valid UTF-8", tt.in, tt.max)
+		}
+	}
+}
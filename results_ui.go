@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// queryPage searches the results database.
+type queryPage struct {
+	*tview.Flex
+	input  *tview.InputField
+	table  *tview.Table
+	status *tview.TextView
+	db     func() *ResultsDB // the current workspace's database
+}
+
+func newQueryPage(app *tview.Application, db func() *ResultsDB, back func()) *queryPage {
+	p := &queryPage{
+		input:  tview.NewInputField().SetLabel("Query: "),
+		table:  tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		status: tview.NewTextView().SetDynamicColors(true),
+		db:     db,
+	}
+	p.input.SetBorder(true).SetTitle("   🔎 Results database   ")
+	themed(p.input, themeAccent)
+	p.input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			p.run()
+		case tcell.KeyTab:
+			app.SetFocus(p.table)
+		case tcell.KeyEscape:
+			back()
+		}
+	})
+	p.table.SetBorder(true).SetTitle("Matches")
+	themed(p.table, themePlain)
+
+	themed(p.status, themePlain)
+	p.status.SetText(tview.Escape(queryHelp))
+
+	help := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	help.SetBorder(true).SetTitle("Query")
+	themed(help, themePlain)
+	help.SetText("◀ Enter search | Tab results | " + keymap.Help("focus_query", "query", "report", "report") +
+		" | " + keymap.Label("results_db") + "/" + keymap.Label("back") + " back ▶")
+
+	p.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(help, 3, 0, false).
+		AddItem(p.input, 3, 0, true).
+		AddItem(p.table, 0, 1, false).
+		AddItem(p.status, 2, 0, false)
+	themed(p.Flex, themePlain)
+	return p
+}
+
+// run executes the query in the input field and fills the table.
+func (p *queryPage) run() {
+	q, err := parseQuery(p.input.GetText(), time.Now())
+	if err != nil {
+		p.status.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	rows, err := p.db().Query(q)
+	if err != nil {
+		p.status.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	p.table.Clear()
+	for c, h := range []string{"Time", "Host", "Hostname", "Port", "State", "Service", "Version"} {
+		p.table.SetCell(0, c, tview.NewTableCell(h).SetTextColor(themeColor(currentTheme.Accent)).SetSelectable(false))
+	}
+	hosts := make(map[string]bool)
+	for i, r := range rows {
+		hosts[r.Addr] = true
+		cells := []string{
+			r.Time.Local().Format("2006-01-02 15:04"),
+			r.Addr,
+			r.Hostname,
+			fmt.Sprintf("%d/%s", r.Port.Port, r.Port.Proto),
+			r.Port.State,
+			r.Port.Service,
+			strings.TrimSpace(r.Port.Product + " " + r.Port.Version),
+		}
+		for c, text := range cells {
+			p.table.SetCell(i+1, c, tview.NewTableCell(tview.Escape(text)))
+		}
+	}
+	p.table.ScrollToBeginning()
+	p.status.SetText(fmt.Sprintf("%d matches on %d hosts", len(rows), len(hosts)))
+}
+
+// reportForm asks for the title, format and file of a report.
+func reportForm(title, path string, done func(title, format, path string, ok bool)) tview.Primitive {
+	formats := []string{"md", "html", "csv", "json"}
+	form := tview.NewForm()
+	form.AddInputField("Title", title, 0, nil, nil)
+	form.AddDropDown("Format", formats, 0, nil)
+	form.AddInputField("File", path, 0, nil, nil)
+	form.AddButton("Save", func() {
+		_, format := form.GetFormItem(1).(*tview.DropDown).GetCurrentOption()
+		file := form.GetFormItem(2).(*tview.InputField).GetText()
+		if filepath.Ext(file) == "" {
+			file += reportFormats[format]
+		}
+		done(form.GetFormItem(0).(*tview.InputField).GetText(), format, file, true)
+	})
+	form.AddButton("Cancel", func() { done("", "", "", false) })
+	form.SetCancelFunc(func() { done("", "", "", false) })
+	form.SetBorder(true).SetTitle("Report of the current query")
+	paintWidget(form, themePlain)
+	return modal(form, 80, 11)
+}
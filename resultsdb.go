@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ---------- results database ----------
+
+// ResultsDB keeps every parsed scan in a bbolt file so results can be
+// queried without re-reading the XML. Inside the file each workspace has
+// its own bucket:
+//
+//	<workspace>/hosts/<addr>\x00<time>  → HostRecord
+//	<workspace>/scans/<time>\x00<source> → ScanRecord
+//
+// Keys sort by host and then by time. The file is opened for each call so
+// `nmapx query` works while the TUI is running.
+type ResultsDB struct {
+	path      string
+	workspace string
+}
+
+// HostRecord is one host as seen by one scan.
+type HostRecord struct {
+	Addr      string       `json:"addr"`
+	Hostnames []string     `json:"hostnames,omitempty"`
+	Status    string       `json:"status"`
+	Time      time.Time    `json:"time"`
+	Source    string       `json:"source"` // file the result was read from
+	Ports     []PortRecord `json:"ports,omitempty"`
+	Scripts   []Script     `json:"scripts,omitempty"` // host script results
+}
+
+type PortRecord struct {
+	Port    int      `json:"port"`
+	Proto   string   `json:"proto"`
+	State   string   `json:"state"`
+	Service string   `json:"service,omitempty"`
+	Product string   `json:"product,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Scripts []Script `json:"scripts,omitempty"`
+}
+
+// ScanRecord describes one stored scan.
+type ScanRecord struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Args   string    `json:"args"`
+	Hosts  int       `json:"hosts"`
+}
+
+const dbTimeKey = "20060102T150405.000000000Z"
+
+// newResultsDB returns the database of a workspace, or the global one in
+// the config directory when ws is nil.
+func newResultsDB(ws *Workspace) *ResultsDB {
+	if ws == nil {
+		return &ResultsDB{path: filepath.Join(configDir(), "results.db"), workspace: "default"}
+	}
+	return &ResultsDB{path: ws.DBPath(), workspace: ws.Name}
+}
+
+func (db *ResultsDB) open() (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(db.path), 0o755); err != nil {
+		return nil, err
+	}
+	b, err := bolt.Open(db.path, 0o600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("results db %s: %w", db.path, err)
+	}
+	return b, nil
+}
+
+// Store saves all hosts of a scan. Storing the same scan again overwrites
+// the earlier records instead of duplicating them.
+func (db *ResultsDB) Store(run *NmapRun, source string) (int, error) {
+	when := time.Now()
+	if run.Start > 0 {
+		when = time.Unix(run.Start, 0)
+	}
+	when = when.UTC()
+	stamp := when.Format(dbTimeKey)
+
+	b, err := db.open()
+	if err != nil {
+		return 0, err
+	}
+	defer b.Close()
+
+	n := 0
+	err = b.Update(func(tx *bolt.Tx) error {
+		ws, err := tx.CreateBucketIfNotExists([]byte(db.workspace))
+		if err != nil {
+			return err
+		}
+		hosts, err := ws.CreateBucketIfNotExists([]byte("hosts"))
+		if err != nil {
+			return err
+		}
+		scans, err := ws.CreateBucketIfNotExists([]byte("scans"))
+		if err != nil {
+			return err
+		}
+		for _, h := range run.Hosts {
+			rec := hostRecord(h, when, source)
+			if rec.Addr == "" {
+				continue
+			}
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := hosts.Put([]byte(rec.Addr+"\x00"+stamp), data); err != nil {
+				return err
+			}
+			n++
+		}
+		data, err := json.Marshal(ScanRecord{Time: when, Source: source, Args: run.Args, Hosts: n})
+		if err != nil {
+			return err
+		}
+		return scans.Put([]byte(stamp+"\x00"+source), data)
+	})
+	return n, err
+}
+
+func hostRecord(h Host, when time.Time, source string) HostRecord {
+	rec := HostRecord{Addr: h.Addr(), Status: h.Status.State, Time: when, Source: source, Scripts: h.HostScripts}
+	for _, hn := range h.Hostnames {
+		rec.Hostnames = append(rec.Hostnames, hn.Name)
+	}
+	for _, p := range h.Ports {
+		rec.Ports = append(rec.Ports, PortRecord{
+			Port:    p.PortID,
+			Proto:   p.Protocol,
+			State:   p.State.State,
+			Service: p.Service.Name,
+			Product: p.Service.Product,
+			Version: p.Service.Version,
+			Scripts: p.Scripts,
+		})
+	}
+	return rec
+}
+
+// Scans lists the stored scans, oldest first.
+func (db *ResultsDB) Scans() ([]ScanRecord, error) {
+	var out []ScanRecord
+	err := db.view(func(ws *bolt.Bucket) error {
+		scans := ws.Bucket([]byte("scans"))
+		if scans == nil {
+			return nil
+		}
+		return scans.ForEach(func(_, v []byte) error {
+			var s ScanRecord
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			out = append(out, s)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// view runs fn on the workspace bucket; a missing file or bucket is empty.
+func (db *ResultsDB) view(fn func(ws *bolt.Bucket) error) error {
+	if _, err := os.Stat(db.path); os.IsNotExist(err) {
+		return nil
+	}
+	b, err := db.open()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	return b.View(func(tx *bolt.Tx) error {
+		ws := tx.Bucket([]byte(db.workspace))
+		if ws == nil {
+			return nil
+		}
+		return fn(ws)
+	})
+}
+
+// ---------- queries ----------
+
+// Query selects ports from stored hosts. Zero fields match everything.
+type Query struct {
+	Ports   []int
+	State   string // port state, "open" unless set; "any" matches all
+	Service string // substring of the service name
+	Host    string // address, CIDR, or part of a hostname
+	Since   time.Time
+	Until   time.Time
+	Latest  bool // only the newest record of each host
+}
+
+// QueryRow is one matching port of one host record.
+type QueryRow struct {
+	Time     time.Time
+	Addr     string
+	Hostname string
+	Source   string
+	Port     PortRecord
+}
+
+const queryHelp = `terms: <port>[,<port>…]  port:3389  service:http  host:10.0.0.0/24  state:open|closed|filtered|any
+       since:30d|24h|today|month|2025-05-01  until:2025-05-31  latest`
+
+// parseQuery reads queries like "3389 since:month" or
+// "service:http host:10.0.4.0/24 latest".
+func parseQuery(s string, now time.Time) (Query, error) {
+	q := Query{State: "open"}
+	for _, term := range strings.Fields(s) {
+		if term == "latest" {
+			q.Latest = true
+			continue
+		}
+		key, val, ok := strings.Cut(term, ":")
+		if !ok {
+			// bare terms: port numbers or a host
+			key, val = "host", term
+			if term[0] >= '0' && term[0] <= '9' && !strings.ContainsAny(term, "./") {
+				key = "port"
+			}
+		}
+		var err error
+		switch key {
+		case "port", "ports":
+			for _, p := range strings.Split(val, ",") {
+				n, perr := strconv.Atoi(p)
+				if perr != nil || n < 1 || n > 65535 {
+					return q, fmt.Errorf("invalid port %q", p)
+				}
+				q.Ports = append(q.Ports, n)
+			}
+		case "state":
+			q.State = val
+		case "service":
+			q.Service = val
+		case "host":
+			q.Host = val
+		case "since":
+			q.Since, err = parseQueryTime(val, now)
+		case "until":
+			q.Until, err = parseQueryTime(val, now)
+			if err == nil && len(val) == len("2006-01-02") {
+				q.Until = q.Until.AddDate(0, 0, 1) // the whole day
+			}
+		default:
+			return q, fmt.Errorf("unknown query term %q\n%s", term, queryHelp)
+		}
+		if err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// parseQueryTime accepts a date, "today", "month" (start of this month)
+// or an age like 30d or 12h.
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case "month":
+		y, m, _ := now.Date()
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location()), nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use 30d, 12h, today, month or 2006-01-02)", s)
+}
+
+// Hosts returns the records that match the host and time terms of q,
+// sorted by address and then time. Ports are not filtered.
+func (db *ResultsDB) Hosts(q Query) ([]HostRecord, error) {
+	var recs []HostRecord
+	err := db.view(func(ws *bolt.Bucket) error {
+		hosts := ws.Bucket([]byte("hosts"))
+		if hosts == nil {
+			return nil
+		}
+		return hosts.ForEach(func(_, v []byte) error {
+			var r HostRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if q.matchHost(r) {
+				if q.Latest && len(recs) > 0 && recs[len(recs)-1].Addr == r.Addr {
+					recs = recs[:len(recs)-1] // keys sort by time, so r is newer
+				}
+				recs = append(recs, r)
+			}
+			return nil
+		})
+	})
+	return recs, err
+}
+
+// Query returns the matching ports, sorted by host and time.
+func (db *ResultsDB) Query(q Query) ([]QueryRow, error) {
+	recs, err := db.Hosts(q)
+	if err != nil {
+		return nil, err
+	}
+	var rows []QueryRow
+	for _, r := range recs {
+		hostname := ""
+		if len(r.Hostnames) > 0 {
+			hostname = r.Hostnames[0]
+		}
+		for _, p := range r.Ports {
+			if q.matchPort(p) {
+				rows = append(rows, QueryRow{Time: r.Time, Addr: r.Addr, Hostname: hostname, Source: r.Source, Port: p})
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Addr != rows[j].Addr {
+			return rows[i].Addr < rows[j].Addr
+		}
+		return rows[i].Time.Before(rows[j].Time)
+	})
+	return rows, nil
+}
+
+func (q Query) matchHost(r HostRecord) bool {
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+	if q.Host == "" || q.Host == r.Addr {
+		return true
+	}
+	if _, cidr, err := net.ParseCIDR(q.Host); err == nil {
+		ip := net.ParseIP(r.Addr)
+		return ip != nil && cidr.Contains(ip)
+	}
+	for _, h := range r.Hostnames {
+		if strings.Contains(strings.ToLower(h), strings.ToLower(q.Host)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q Query) matchPort(p PortRecord) bool {
+	if q.State != "" && q.State != "any" && p.State != q.State {
+		return false
+	}
+	if q.Service != "" && !strings.Contains(p.Service, q.Service) {
+		return false
+	}
+	if len(q.Ports) == 0 {
+		return true
+	}
+	for _, n := range q.Ports {
+		if p.Port == n {
+			return true
+		}
+	}
+	return false
+}
+
+// storeFile parses a results file (nmap XML or the output of another
+// backend) and stores it.
+func (db *ResultsDB) storeFile(path string) (int, error) {
+	run, _, err := parseNmapFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return db.Store(run, path)
+}
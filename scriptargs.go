@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ---------- NSE --script-args ----------
+
+// ScriptArg is one value for --script-args.
+type ScriptArg struct {
+	Script string // script that documents the argument, "" if typed by hand
+	Name   string
+	Value  string
+}
+
+var (
+	timespecRe = regexp.MustCompile(`^\d+(\.\d+)?(ms|s|m|h)?$`)
+	integerRe  = regexp.MustCompile(`^-?\d+$`)
+	argNameRe  = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// validateScriptArg checks a value against what the script's documentation
+// says about the argument: time specs for timeouts and delays, whole
+// numbers for counts, balanced braces for tables.
+func validateScriptArg(a NSEArg, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%s: the value cannot span lines", a.Name)
+	}
+	name := strings.ToLower(a.Name)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	desc := strings.ToLower(a.Desc)
+	switch {
+	case strings.HasPrefix(value, "{") != strings.HasSuffix(value, "}"):
+		return fmt.Errorf("%s: a table must be written as {a,b,c}", a.Name)
+	case strings.HasPrefix(value, "{"):
+		// tables are passed as written
+	case strings.Contains(name, "timeout") || strings.Contains(name, "delay") || strings.Contains(desc, "timespec"):
+		if !timespecRe.MatchString(value) {
+			return fmt.Errorf("%s: expected a time like 500ms, 10s or 2m", a.Name)
+		}
+	case strings.Contains(desc, "integer") || strings.Contains(desc, "number of") ||
+		name == "threads" || name == "retries" || name == "limit" || name == "bytes" || name == "maxdepth" || name == "maxpagecount":
+		if !integerRe.MatchString(value) {
+			return fmt.Errorf("%s: expected a whole number", a.Name)
+		}
+	}
+	return nil
+}
+
+// quoteScriptArg writes a value in nmap's --script-args syntax: plain if
+// it has none of its separators, a {table} as is, otherwise in double
+// quotes with \ and " escaped.
+func quoteScriptArg(v string) string {
+	if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+		return v
+	}
+	if v != "" && !strings.ContainsAny(v, ",={}\"'\\ \t") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// formatScriptArgs joins arguments as name=value,name=value.
+func formatScriptArgs(args []ScriptArg) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = a.Name + "=" + quoteScriptArg(a.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseScriptArgs reads name=value pairs as typed for --script-args.
+// Commas inside quotes or braces do not separate pairs.
+func parseScriptArgs(s string) ([]ScriptArg, error) {
+	var args []ScriptArg
+	var cur strings.Builder
+	var quote rune
+	depth := 0
+	escaped := false
+	flush := func() error {
+		pair := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if pair == "" {
+			return nil
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !argNameRe.MatchString(name) {
+			return fmt.Errorf("%q is not name=value", pair)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\'`, `'`).Replace(value[1 : len(value)-1])
+		}
+		args = append(args, ScriptArg{Name: name, Value: value})
+		return nil
+	}
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced braces")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// scriptArgsOption is the nmap option passing args, quoted for the command
+// line: --script-args-file when file is set, "" without arguments.
+func scriptArgsOption(args []ScriptArg, file string) string {
+	if file != "" {
+		return shellQuote("--script-args-file=" + file)
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return shellQuote("--script-args=" + formatScriptArgs(args))
+}
+
+// writeScriptArgsFile saves args for --script-args-file, one per line, in
+// dir and returns the file's absolute path.
+func writeScriptArgsFile(dir string, args []ScriptArg) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(filepath.Join(dir, "script-args-"+time.Now().Format("20060102-150405")+".txt"))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, a := range args {
+		b.WriteString(a.Name + "=" + quoteScriptArg(a.Value) + "\n")
+	}
+	return path, os.WriteFile(path, []byte(b.String()), 0o644)
+}
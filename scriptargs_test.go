@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScriptArgsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		args []ScriptArg
+		want string // the option as nmap receives it
+	}{
+		{"plain", []ScriptArg{{Name: "http.useragent", Value: "Mozilla"}}, "--script-args=http.useragent=Mozilla"},
+		{"comma", []ScriptArg{{Name: "userdb", Value: "a,b"}, {Name: "passdb", Value: "p.txt"}}, `--script-args=userdb="a,b",passdb=p.txt`},
+		{"spaces", []ScriptArg{{Name: "http.useragent", Value: "Mozilla/5.0 (X11; Linux)"}}, `--script-args=http.useragent="Mozilla/5.0 (X11; Linux)"`},
+		{"equals", []ScriptArg{{Name: "http-form-brute.path", Value: "/login?next=/a"}}, `--script-args=http-form-brute.path="/login?next=/a"`},
+		{"double quotes", []ScriptArg{{Name: "smbdomain", Value: `say "hi"`}}, `--script-args=smbdomain="say \"hi\""`},
+		{"single quote", []ScriptArg{{Name: "smbpassword", Value: "it's"}}, `--script-args=smbpassword="it's"`},
+		{"backslash", []ScriptArg{{Name: "smbusername", Value: `ACME\admin`}}, `--script-args=smbusername="ACME\\admin"`},
+		{"table", []ScriptArg{{Name: "vulns.showall", Value: "{a,b}"}}, "--script-args=vulns.showall={a,b}"},
+		{"empty", []ScriptArg{{Name: "creds.global", Value: ""}}, `--script-args=creds.global=""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := scriptArgsOption(tt.args, "")
+			// the command line goes through splitArgs before it is run
+			got, err := splitArgs("nmap " + opt + " 10.0.0.1")
+			if err != nil {
+				t.Fatalf("splitArgs(%q): %v", opt, err)
+			}
+			if len(got) != 3 || got[1] != tt.want {
+				t.Fatalf("splitArgs(%q) = %q, want [nmap %q 10.0.0.1]", opt, got, tt.want)
+			}
+			// nmap reads the same values back
+			back, err := parseScriptArgs(strings.TrimPrefix(got[1], "--script-args="))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(back, tt.args) {
+				t.Errorf("parseScriptArgs = %+v, want %+v", back, tt.args)
+			}
+		})
+	}
+}
+
+func TestScriptArgsFileOption(t *testing.T) {
+	opt := scriptArgsOption([]ScriptArg{{Name: "a", Value: "1"}}, "My Scans/args.txt")
+	got, err := splitArgs(opt)
+	if err != nil || len(got) != 1 || got[0] != "--script-args-file=My Scans/args.txt" {
+		t.Errorf("splitArgs(%q) = %q, %v", opt, got, err)
+	}
+	if scriptArgsOption(nil, "") != "" {
+		t.Error("no args should give no option")
+	}
+}
+
+func TestParseScriptArgsErrors(t *testing.T) {
+	for _, in := range []string{`a="open`, "a={b,c", "novalue", "bad name=1"} {
+		if _, err := parseScriptArgs(in); err == nil {
+			t.Errorf("parseScriptArgs(%q) gave no error", in)
+		}
+	}
+}
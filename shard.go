@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ---------- sharded scans ----------
+
+// ShardConfig holds the defaults of the sharded scan form ('S').
+type ShardConfig struct {
+	Shards      int `json:"shards"`      // chunks the targets are split into
+	Concurrency int `json:"concurrency"` // shards queued at the same time
+	Retries     int `json:"retries"`     // extra attempts for a shard whose nmap failed
+}
+
+func defaultShardConfig() ShardConfig {
+	return ShardConfig{Shards: 8, Concurrency: 4, Retries: 1}
+}
+
+// 10.0.0.1-254: a range in the last octet
+var lastOctetRangeRe = regexp.MustCompile(`^(\d+\.\d+\.\d+\.)(\d+)-(\d+)$`)
+
+// targetUnit is a piece of the target set: a range of IPv4 addresses, or a
+// target that cannot be split (hostname, IPv6, octet ranges), kept whole.
+type targetUnit struct {
+	first, last uint32
+	spec        string // set for targets kept whole
+}
+
+func (u targetUnit) size() uint64 {
+	if u.spec != "" {
+		return 1
+	}
+	return uint64(u.last) - uint64(u.first) + 1
+}
+
+func ipv4Int(ip net.IP) (uint32, bool) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ip4), true
+}
+
+func intIPv4(n uint32) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip.String()
+}
+
+// targetUnits reads nmap target specifications.
+func targetUnits(targets []string) []targetUnit {
+	var units []targetUnit
+	for _, t := range targets {
+		if _, n, err := net.ParseCIDR(t); err == nil {
+			if first, ok := ipv4Int(n.IP); ok {
+				ones, _ := n.Mask.Size()
+				last := uint32(uint64(first) + (uint64(1) << uint(32-ones)) - 1)
+				units = append(units, targetUnit{first: first, last: last})
+				continue
+			}
+		}
+		if n, ok := ipv4Int(net.ParseIP(t)); ok {
+			units = append(units, targetUnit{first: n, last: n})
+			continue
+		}
+		if m := lastOctetRangeRe.FindStringSubmatch(t); m != nil {
+			from, _ := strconv.Atoi(m[2])
+			to, _ := strconv.Atoi(m[3])
+			base, ok := ipv4Int(net.ParseIP(m[1] + "0"))
+			if ok && from <= to && to <= 255 {
+				units = append(units, targetUnit{first: base + uint32(from), last: base + uint32(to)})
+				continue
+			}
+		}
+		units = append(units, targetUnit{spec: t})
+	}
+	return units
+}
+
+// rangeCIDRs writes first-last as the fewest CIDR blocks; single addresses
+// without a mask.
+func rangeCIDRs(first, last uint32) []string {
+	var out []string
+	for start := uint64(first); start <= uint64(last); {
+		// the largest aligned block starting at start that ends before last
+		size := uint(bits.TrailingZeros32(uint32(start)))
+		if start == 0 {
+			size = 32
+		}
+		for size > 0 && start+(uint64(1)<<size)-1 > uint64(last) {
+			size--
+		}
+		if size == 0 {
+			out = append(out, intIPv4(uint32(start)))
+		} else {
+			out = append(out, fmt.Sprintf("%s/%d", intIPv4(uint32(start)), 32-size))
+		}
+		start += uint64(1) << size
+	}
+	return out
+}
+
+// splitTargets divides the addresses of targets into at most n chunks of
+// about the same size, each written as nmap targets. Ranges and CIDR
+// blocks are cut where needed; other targets go whole into one chunk.
+func splitTargets(targets []string, n int) [][]string {
+	units := targetUnits(targets)
+	var total uint64
+	for _, u := range units {
+		total += u.size()
+	}
+	if n < 1 {
+		n = 1
+	}
+	if total == 0 {
+		return nil
+	}
+	per := (total + uint64(n) - 1) / uint64(n)
+	var chunks [][]string
+	var cur []string
+	var room = per
+	flush := func() {
+		if len(cur) > 0 {
+			chunks = append(chunks, cur)
+		}
+		cur, room = nil, per
+	}
+	for _, u := range units {
+		if u.spec != "" {
+			cur = append(cur, u.spec)
+			if room--; room == 0 {
+				flush()
+			}
+			continue
+		}
+		for first := uint64(u.first); first <= uint64(u.last); {
+			last := first + room - 1
+			if last > uint64(u.last) {
+				last = uint64(u.last)
+			}
+			cur = append(cur, rangeCIDRs(uint32(first), uint32(last))...)
+			room -= last - first + 1
+			first = last + 1
+			if room == 0 {
+				flush()
+			}
+		}
+	}
+	flush()
+	return chunks
+}
+
+// shardBase removes the targets and the file output options from an nmap
+// command line: each shard gets its own targets and -oA.
+func shardBase(args []string) ([]string, error) {
+	at := -1
+	for i, a := range args {
+		if filepath.Base(a) == "nmap" {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return nil, fmt.Errorf("only nmap scans can be sharded")
+	}
+	base := append([]string(nil), args[:at+1]...)
+	for i := at + 1; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-iL" || a == "--resume":
+			return nil, fmt.Errorf("%s: sharding needs the targets on the command line", a)
+		case outputFlags[a]:
+			i++
+		case nmapValueFlags[a]:
+			if i+1 < len(args) {
+				base = append(base, a, args[i+1])
+			}
+			i++
+		case strings.HasPrefix(a, "-"):
+			base = append(base, a)
+		}
+	}
+	return base, nil
+}
+
+// Shard is one chunk of a sharded scan.
+type Shard struct {
+	Targets  []string
+	State    StepState
+	Attempts int
+	Job      *Job // latest attempt
+	Err      error
+}
+
+// ShardRun scans the chunks of a target set as separate nmap jobs, at most
+// Concurrency at once, retries the ones that fail and merges their XML into
+// merged.xml in Dir when all have finished.
+type ShardRun struct {
+	ID          int
+	Cmd         string // the scan as entered, with every target
+	Dir         string
+	Concurrency int
+	Retries     int
+	// OnChange is called, outside the run's lock, whenever a shard changes.
+	OnChange func(*ShardRun)
+
+	// launch queues one job; called from the run's own goroutines.
+	launch func(name, cmdline string, then JobOption) error
+
+	base     []string
+	mu       sync.Mutex
+	shards   []Shard
+	merged   string
+	mergeErr error
+}
+
+func newShardRun(id int, cmdline, dir string, cfg ShardConfig, launch func(name, cmdline string, then JobOption) error) (*ShardRun, error) {
+	args, err := splitArgs(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	base, err := shardBase(args)
+	if err != nil {
+		return nil, err
+	}
+	// absolute, so that prepareScan does not move the shard outputs
+	// into another scan folder (output.relocate)
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	chunks := splitTargets(nmapTargets(args), cfg.Shards)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("the scan has no targets to shard")
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	r := &ShardRun{
+		ID: id, Cmd: cmdline, Dir: dir, Concurrency: cfg.Concurrency, Retries: cfg.Retries,
+		launch: launch, base: base, shards: make([]Shard, len(chunks)),
+	}
+	for i, c := range chunks {
+		r.shards[i].Targets = c
+	}
+	return r, nil
+}
+
+// Start queues the first shards.
+func (r *ShardRun) Start() {
+	go r.fill()
+}
+
+// Shards returns a snapshot of the shards.
+func (r *ShardRun) Shards() []Shard {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Shard(nil), r.shards...)
+}
+
+// States returns the state of every shard, for the Pipelines page.
+func (r *ShardRun) States() []StepState {
+	var states []StepState
+	for _, s := range r.Shards() {
+		states = append(states, s.State)
+	}
+	return states
+}
+
+// Finished reports whether the merged result has been written (or failed).
+func (r *ShardRun) Finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.merged != "" || (r.mergeErr != nil && r.mergeErr != errMerging)
+}
+
+// shardCommand is the command line of shard i.
+func (r *ShardRun) shardCommand(i int) string {
+	args := append(append([]string(nil), r.base...), "-oA", r.shardOutput(i))
+	return joinArgs(append(args, r.shards[i].Targets...))
+}
+
+// shardOutput is the -oA base name of shard i.
+func (r *ShardRun) shardOutput(i int) string {
+	return filepath.Join(r.Dir, fmt.Sprintf("shard-%02d", i+1))
+}
+
+// fill queues pending shards while fewer than Concurrency are running.
+func (r *ShardRun) fill() {
+	for {
+		r.mu.Lock()
+		running, next := 0, -1
+		for i, s := range r.shards {
+			switch {
+			case s.State == StepRunning:
+				running++
+			case s.State == StepPending && next < 0:
+				next = i
+			}
+		}
+		if next < 0 || running >= r.Concurrency {
+			r.mu.Unlock()
+			break
+		}
+		s := &r.shards[next]
+		s.State = StepRunning
+		s.Attempts++
+		name := fmt.Sprintf("Shard %d/%d: %s", next+1, len(r.shards), s.Targets[0])
+		if len(s.Targets) > 1 {
+			name += " …"
+		}
+		cmd := r.shardCommand(next)
+		r.mu.Unlock()
+		r.changed()
+
+		i := next
+		// remember the job as soon as it is queued, for its progress
+		track := func(j *Job) {
+			j.then = func(j *Job) { r.shardDone(i, j) }
+			r.mu.Lock()
+			r.shards[i].Job = j
+			r.mu.Unlock()
+		}
+		if err := r.launch(name, cmd, track); err != nil {
+			r.mu.Lock()
+			r.shards[i].State = StepFailed
+			r.shards[i].Err = err
+			r.mu.Unlock()
+			r.changed()
+		}
+	}
+	r.finishIfDone()
+}
+
+// shardDone is the Then hook of every shard job.
+func (r *ShardRun) shardDone(i int, j *Job) {
+	st, err := j.State()
+	r.mu.Lock()
+	s := &r.shards[i]
+	s.Job = j
+	switch {
+	case st == JobDone:
+		s.State, s.Err = StepDone, nil
+	case st == JobFailed && s.Attempts <= r.Retries:
+		s.State, s.Err = StepPending, err // queued again by fill
+	case st == JobCancelled:
+		s.State, s.Err = StepFailed, fmt.Errorf("cancelled")
+	default:
+		s.State, s.Err = StepFailed, err
+	}
+	r.mu.Unlock()
+	r.changed()
+	// may be running on the UI goroutine if the job could not start
+	go r.fill()
+}
+
+// finishIfDone merges the shards once none is pending or running.
+func (r *ShardRun) finishIfDone() {
+	r.mu.Lock()
+	if r.merged != "" || r.mergeErr != nil {
+		r.mu.Unlock()
+		return
+	}
+	var paths []string
+	for i, s := range r.shards {
+		switch s.State {
+		case StepPending, StepRunning:
+			r.mu.Unlock()
+			return
+		case StepDone:
+			paths = append(paths, r.shardOutput(i)+".xml")
+		}
+	}
+	// claim the merge so a concurrent fill does not repeat it
+	r.mergeErr = errMerging
+	r.mu.Unlock()
+
+	path := filepath.Join(r.Dir, "merged.xml")
+	err := mergeShardXML(paths, r.Cmd, path)
+	r.mu.Lock()
+	if err != nil {
+		r.mergeErr = err
+	} else {
+		r.merged, r.mergeErr = path, nil
+	}
+	r.mu.Unlock()
+	r.changed()
+}
+
+var errMerging = fmt.Errorf("merging")
+
+// mergeShardXML joins the XML of the finished shards into one nmaprun.
+func mergeShardXML(paths []string, cmd, out string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no shard finished, nothing to merge")
+	}
+	merged, err := mergeNmapFiles(paths, cmd)
+	if err != nil {
+		return err
+	}
+	return writeNmapXML(out, merged)
+}
+
+func (r *ShardRun) changed() {
+	if r.OnChange != nil {
+		r.OnChange(r)
+	}
+}
+
+// Status renders the run as lines of text: a title, then one per shard.
+func (r *ShardRun) Status() []string {
+	shards := r.Shards()
+	done := 0
+	for _, s := range shards {
+		if s.State == StepDone {
+			done++
+		}
+	}
+	r.mu.Lock()
+	merged, mergeErr := r.merged, r.mergeErr
+	r.mu.Unlock()
+	title := fmt.Sprintf("#%d sharded: %s  %d/%d shards done", r.ID, r.Cmd, done, len(shards))
+	switch {
+	case merged != "":
+		title += "  merged into " + merged
+	case mergeErr == errMerging:
+		title += "  merging…"
+	case mergeErr != nil:
+		title += "  merge failed: " + mergeErr.Error()
+	}
+	lines := []string{title}
+	for i, s := range shards {
+		line := fmt.Sprintf("  %-8s shard %d  %s", s.State, i+1, strings.Join(s.Targets, " "))
+		if s.State == StepRunning && s.Job != nil {
+			if p := s.Job.Progress(); p.Known {
+				line += fmt.Sprintf("  %.0f%%", p.Percent)
+			}
+		}
+		if s.Attempts > 1 {
+			line += fmt.Sprintf("  attempt %d/%d", s.Attempts, r.Retries+1)
+		}
+		if s.Err != nil {
+			line += "  " + s.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTargets(t *testing.T) {
+	tests := []struct {
+		targets []string
+		n       int
+		want    [][]string
+	}{
+		{[]string{"10.0.0.0/24"}, 2, [][]string{{"10.0.0.0/25"}, {"10.0.0.128/25"}}},
+		{[]string{"10.0.0.0/24"}, 4, [][]string{{"10.0.0.0/26"}, {"10.0.0.64/26"}, {"10.0.0.128/26"}, {"10.0.0.192/26"}}},
+		{[]string{"10.0.0.1-4"}, 2, [][]string{{"10.0.0.1", "10.0.0.2"}, {"10.0.0.3", "10.0.0.4"}}},
+		{[]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, 8, [][]string{{"10.0.0.1"}, {"10.0.0.2"}, {"10.0.0.3"}}},
+		{[]string{"10.0.0.0/31", "dc01", "web.acme.local"}, 2, [][]string{{"10.0.0.0/31"}, {"dc01", "web.acme.local"}}},
+		{[]string{"10.0.0.0/24"}, 1, [][]string{{"10.0.0.0/24"}}},
+		{nil, 4, nil},
+	}
+	for _, tt := range tests {
+		got := splitTargets(tt.targets, tt.n)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTargets(%q, %d) = %q, want %q", tt.targets, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestShardBase(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		want    string
+		wantErr bool
+	}{
+		{"nmap -sS -p 22,80 -oA out 10.0.0.0/24", "nmap -sS -p 22,80", false},
+		{"sudo nmap -sV --script-timeout 30s --exclude-ports 25 10.0.0.0/24 dc01", "sudo nmap -sV --script-timeout 30s --exclude-ports 25", false},
+		{"nmap -sS -oX a.xml -oN a.txt -oM a.gnmap --top-ports 100 10.0.0.1", "nmap -sS --top-ports 100", false},
+		{"nmap -sS -iL hosts.txt", "", true},
+		{"masscan -p80 10.0.0.0/8", "", true},
+	}
+	for _, tt := range tests {
+		args, _ := splitArgs(tt.cmd)
+		base, err := shardBase(args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("shardBase(%q) error = %v", tt.cmd, err)
+			continue
+		}
+		if err == nil && joinArgs(base) != tt.want {
+			t.Errorf("shardBase(%q) = %q, want %q", tt.cmd, joinArgs(base), tt.want)
+		}
+	}
+}
+
+func TestShardCommands(t *testing.T) {
+	chdirTemp(t)
+	o := newOutputManager(OutputConfig{Dir: "nmapx-scans", AutoOA: true, Relocate: true})
+	dir, err := o.NewScanDir("10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noLaunch := func(name, cmdline string, then JobOption) error { return nil }
+	r, err := newShardRun(1, "nmap -sS -T4 -oA x 10.0.0.0/24", dir, ShardConfig{Shards: 2, Concurrency: 1}, noLaunch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(r.Dir) {
+		t.Fatalf("shard dir %q is not absolute", r.Dir)
+	}
+	for i, target := range []string{"10.0.0.0/25", "10.0.0.128/25"} {
+		out := filepath.Join(r.Dir, "shard-0"+string(rune('1'+i)))
+		want := joinArgs([]string{"nmap", "-sS", "-T4", "-oA", out, target})
+		cmd := r.shardCommand(i)
+		if cmd != want {
+			t.Errorf("shard %d: %q, want %q", i, cmd, want)
+		}
+		// the command reaches the queue as it is, so the merge finds its XML
+		prepared, err := prepareScan(nil, o, nil, "shard", cmd, target, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prepared != cmd {
+			t.Errorf("prepareScan moved shard %d: %q", i, prepared)
+		}
+		if !strings.HasPrefix(r.shardOutput(i), r.Dir) {
+			t.Errorf("shard output %q outside %q", r.shardOutput(i), r.Dir)
+		}
+	}
+}
+
+// chdirTemp runs the test in a new temporary directory.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ---------- colour themes ----------
+
+// Theme is a named colour scheme for every widget. Colours are tcell
+// names ("darkblue", "white"), #rrggbb, or "default" for the terminal's
+// own colour.
+type Theme struct {
+	Name       string `json:"name"`
+	Background string `json:"background"`
+	Field      string `json:"field"` // input fields and buttons
+	Border     string `json:"border"`
+	Focus      string `json:"focus"` // border of the focused list or button
+	Title      string `json:"title"`
+	Graphics   string `json:"graphics"`
+	Text       string `json:"text"`
+	Secondary  string `json:"secondary"` // second lines and labels
+	Accent     string `json:"accent"`    // borders of the other screens, table headers
+	Inverse    string `json:"inverse"`   // text over a Text background (selected items)
+
+	mono bool // NO_COLOR: no colours at all, see monoScreen
+}
+
+// builtinThemes: la primera es la de siempre y la predeterminada
+var builtinThemes = []Theme{
+	{Name: "blue", Background: "darkblue", Field: "darkblue", Border: "green", Focus: "yellow",
+		Title: "green", Graphics: "lightcyan", Text: "white", Secondary: "lightgrey", Accent: "yellow", Inverse: "darkblue"},
+	{Name: "dark", Background: "black", Field: "#303030", Border: "grey", Focus: "aqua",
+		Title: "aqua", Graphics: "teal", Text: "white", Secondary: "silver", Accent: "aqua", Inverse: "black"},
+	{Name: "light", Background: "white", Field: "gainsboro", Border: "grey", Focus: "blue",
+		Title: "navy", Graphics: "grey", Text: "black", Secondary: "dimgrey", Accent: "darkred", Inverse: "white"},
+	{Name: "high-contrast", Background: "black", Field: "navy", Border: "white", Focus: "yellow",
+		Title: "white", Graphics: "white", Text: "white", Secondary: "yellow", Accent: "yellow", Inverse: "black"},
+	{Name: "solarized", Background: "#002b36", Field: "#073642", Border: "#586e75", Focus: "#b58900",
+		Title: "#268bd2", Graphics: "#2aa198", Text: "#93a1a1", Secondary: "#839496", Accent: "#cb4b16", Inverse: "#002b36"},
+}
+
+// monoTheme is used when NO_COLOR is set. Text and Field are not
+// "default" so that monoScreen draws selections and fields reversed.
+var monoTheme = Theme{Name: "no-color", Background: "default", Field: "white", Border: "default",
+	Focus: "default", Title: "default", Graphics: "default", Text: "white", Secondary: "default",
+	Accent: "default", Inverse: "default", mono: true}
+
+// noColor reports whether the NO_COLOR convention (https://no-color.org)
+// asks for no colours: the variable is set and not empty.
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// themeColor resolves a colour name; "" and "default" are the terminal's.
+func themeColor(name string) tcell.Color {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "default" {
+		return tcell.ColorDefault
+	}
+	return tcell.GetColor(name)
+}
+
+// validColor reports whether themeColor knows the name.
+func validColor(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name == "" || name == "default" || tcell.GetColor(name) != tcell.ColorDefault
+}
+
+// colors returns pointers to the colour fields, for filling and checking.
+func (t *Theme) colors() map[string]*string {
+	return map[string]*string{
+		"background": &t.Background, "field": &t.Field, "border": &t.Border, "focus": &t.Focus,
+		"title": &t.Title, "graphics": &t.Graphics, "text": &t.Text, "secondary": &t.Secondary,
+		"accent": &t.Accent, "inverse": &t.Inverse,
+	}
+}
+
+// loadThemes returns the builtin themes followed by the ones in config.
+// A config theme with a builtin's name replaces it; colours it leaves out
+// come from the blue theme. Themes with unknown colours are reported and
+// skipped.
+func loadThemes(custom []Theme) ([]Theme, []error) {
+	themes := append([]Theme(nil), builtinThemes...)
+	var errs []error
+	for _, t := range custom {
+		if t.Name == "" {
+			errs = append(errs, fmt.Errorf("theme without a name"))
+			continue
+		}
+		base := builtinThemes[0]
+		fields, defaults := t.colors(), base.colors()
+		bad := ""
+		for key, v := range fields {
+			if *v == "" {
+				*v = *defaults[key]
+			} else if !validColor(*v) && bad == "" {
+				bad = key + " " + *v
+			}
+		}
+		if bad != "" {
+			errs = append(errs, fmt.Errorf("theme %q: unknown colour (%s)", t.Name, bad))
+			continue
+		}
+		if i := themeIndex(themes, t.Name); i >= 0 {
+			themes[i] = t
+		} else {
+			themes = append(themes, t)
+		}
+	}
+	return themes, errs
+}
+
+// themeIndex returns the position of the named theme, or -1.
+func themeIndex(themes []Theme, name string) int {
+	for i, t := range themes {
+		if strings.EqualFold(t.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// styles are the tview defaults for widgets created under the theme.
+func (t Theme) styles() tview.Theme {
+	return tview.Theme{
+		PrimitiveBackgroundColor:    themeColor(t.Background),
+		ContrastBackgroundColor:     themeColor(t.Field),
+		MoreContrastBackgroundColor: themeColor(t.Field),
+		BorderColor:                 themeColor(t.Border),
+		TitleColor:                  themeColor(t.Title),
+		GraphicsColor:               themeColor(t.Graphics),
+		PrimaryTextColor:            themeColor(t.Text),
+		SecondaryTextColor:          themeColor(t.Secondary),
+		TertiaryTextColor:           themeColor(t.Accent),
+		InverseTextColor:            themeColor(t.Inverse),
+		ContrastSecondaryTextColor:  themeColor(t.Secondary),
+	}
+}
+
+// how a widget's border follows the theme
+const (
+	themePlain  = iota // Border colour
+	themeFocus         // Focus colour while focused, else Border
+	themeAccent        // always Accent: the main widget of a screen
+)
+
+// themeable is what every tview widget gets from its embedded Box.
+type themeable interface {
+	SetBackgroundColor(tcell.Color) *tview.Box
+	SetBorderColor(tcell.Color) *tview.Box
+	SetTitleColor(tcell.Color) *tview.Box
+	SetBorderAttributes(tcell.AttrMask) *tview.Box
+	SetFocusFunc(func()) *tview.Box
+	SetBlurFunc(func()) *tview.Box
+	HasFocus() bool
+}
+
+type themedWidget struct {
+	w    themeable
+	role int
+}
+
+var (
+	currentTheme  = builtinThemes[0]
+	themedWidgets []themedWidget // repintados por applyTheme
+)
+
+// themed colours a widget that lives as long as the app and remembers it,
+// so that switching themes repaints it. themeFocus widgets get focus and
+// blur funcs that swap their border colour.
+func themed(w themeable, role int) {
+	paintWidget(w, role)
+	if role == themeFocus {
+		w.SetFocusFunc(func() { paintBorder(w, role, true) })
+		w.SetBlurFunc(func() { paintBorder(w, role, false) })
+	}
+	themedWidgets = append(themedWidgets, themedWidget{w, role})
+}
+
+// applyTheme makes t the current theme: the tview defaults for new
+// widgets, and the colours of every themed widget.
+func applyTheme(t Theme) {
+	currentTheme = t
+	tview.Styles = t.styles()
+	for _, tw := range themedWidgets {
+		paintWidget(tw.w, tw.role)
+	}
+}
+
+// paintBorder colours the border for the role; with no colours the
+// focused widget gets a bold border instead.
+func paintBorder(w themeable, role int, focused bool) {
+	t := currentTheme
+	switch {
+	case role == themeAccent:
+		w.SetBorderColor(themeColor(t.Accent))
+	case role == themeFocus && focused:
+		w.SetBorderColor(themeColor(t.Focus))
+	default:
+		w.SetBorderColor(themeColor(t.Border))
+	}
+	if t.mono && role == themeFocus && focused {
+		w.SetBorderAttributes(tcell.AttrBold)
+	} else {
+		w.SetBorderAttributes(0)
+	}
+}
+
+// paintWidget colours a widget with the current theme. Short-lived forms
+// call it directly instead of themed.
+func paintWidget(w themeable, role int) {
+	t := currentTheme
+	bg, field, text := themeColor(t.Background), themeColor(t.Field), themeColor(t.Text)
+	secondary := themeColor(t.Secondary)
+	w.SetBackgroundColor(bg)
+	w.SetTitleColor(themeColor(t.Title))
+	paintBorder(w, role, w.HasFocus())
+	switch v := w.(type) {
+	case *tview.List:
+		v.SetMainTextColor(text).
+			SetSecondaryTextColor(secondary).
+			SetShortcutColor(secondary).
+			SetSelectedTextColor(themeColor(t.Inverse)).
+			SetSelectedBackgroundColor(text)
+	case *tview.TextView:
+		v.SetTextColor(text)
+	case *tview.InputField:
+		v.SetFieldBackgroundColor(field).
+			SetFieldTextColor(text).
+			SetLabelColor(secondary)
+	case *tview.Form:
+		v.SetFieldBackgroundColor(field).
+			SetFieldTextColor(text).
+			SetLabelColor(secondary).
+			SetButtonBackgroundColor(field).
+			SetButtonTextColor(text)
+	case *tview.Button:
+		v.SetStyle(tcell.StyleDefault.Background(field).Foreground(text))
+		v.SetActivatedStyle(tcell.StyleDefault.Background(text).Foreground(themeColor(t.Inverse)))
+	case *tview.Table:
+		// las cabeceras no se pueden seleccionar
+		for r := 0; r < v.GetRowCount(); r++ {
+			for c := 0; c < v.GetColumnCount(); c++ {
+				if cell := v.GetCell(r, c); cell.NotSelectable {
+					cell.SetTextColor(themeColor(t.Accent))
+				} else {
+					cell.SetTextColor(text)
+				}
+			}
+		}
+	}
+}
+
+// nextTheme returns the theme after the current one, wrapping around.
+func nextTheme(themes []Theme) Theme {
+	i := themeIndex(themes, currentTheme.Name)
+	return themes[(i+1)%len(themes)]
+}
+
+// ---------- NO_COLOR ----------
+
+// monoScreen drops every colour the widgets and [colour] tags ask for,
+// keeping bold, underline and the like. A cell drawn over a background
+// colour (a selected item, an input field) is drawn reversed instead.
+type monoScreen struct {
+	tcell.Screen
+}
+
+func monoStyle(st tcell.Style) tcell.Style {
+	_, bg, attr := st.Decompose()
+	if bg != tcell.ColorDefault {
+		attr |= tcell.AttrReverse
+	}
+	return tcell.StyleDefault.Attributes(attr)
+}
+
+func (s monoScreen) SetContent(x, y int, primary rune, combining []rune, style tcell.Style) {
+	s.Screen.SetContent(x, y, primary, combining, monoStyle(style))
+}
+
+func (s monoScreen) SetCell(x, y int, style tcell.Style, ch ...rune) {
+	s.Screen.SetCell(x, y, monoStyle(style), ch...)
+}
+
+func (s monoScreen) Fill(r rune, style tcell.Style) {
+	s.Screen.Fill(r, monoStyle(style))
+}
+
+func (s monoScreen) SetStyle(style tcell.Style) {
+	s.Screen.SetStyle(monoStyle(style))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// ErrBudget is returned by Ask once the monthly budget has been spent.
+var ErrBudget = errors.New("monthly AI budget exceeded")
+
+// ErrNoPrice is returned by Ask when a budget is set but the model has no
+// price, so its spend could not be counted.
+var ErrNoPrice = errors.New("no price for the model")
+
+// Usage is the token count block of a chat completions response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Price is the cost in USD per million tokens for one model.
+type Price struct {
+	PromptPer1M     float64 `json:"prompt_per_1m"`
+	CompletionPer1M float64 `json:"completion_per_1m"`
+}
+
+func defaultPrices() map[string]Price {
+	return map[string]Price{
+		"gpt-4o-mini":  {PromptPer1M: 0.15, CompletionPer1M: 0.60},
+		"gpt-4o":       {PromptPer1M: 2.50, CompletionPer1M: 10.00},
+		"gpt-4.1-mini": {PromptPer1M: 0.40, CompletionPer1M: 1.60},
+		"gpt-4.1":      {PromptPer1M: 2.00, CompletionPer1M: 8.00},
+	}
+}
+
+// UsageTotals accumulates requests, tokens and estimated cost.
+type UsageTotals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t UsageTotals) String() string {
+	return fmt.Sprintf("%d tok $%.4f", t.PromptTokens+t.CompletionTokens, t.CostUSD)
+}
+
+// UsageTracker keeps per-session totals in memory and per-month totals in
+// usage.json under the config directory, so the budget survives restarts.
+type UsageTracker struct {
+	prices map[string]Price
+	budget float64 // USD per calendar month, 0 = no cap
+	path   string
+	now    func() time.Time
+
+	// OnChange is called after every recorded request.
+	OnChange func()
+
+	mu       sync.Mutex
+	session  UsageTotals
+	months   map[string]UsageTotals // "2006-01" -> totals
+	saveErr  error
+	unpriced string // last model recorded without a price
+}
+
+func newUsageTracker(cfg ExplainConfig, path string) *UsageTracker {
+	t := &UsageTracker{
+		prices: cfg.Prices,
+		budget: cfg.MonthlyBudgetUSD,
+		path:   path,
+		now:    time.Now,
+		months: make(map[string]UsageTotals),
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &t.months)
+	}
+	return t
+}
+
+func (t *UsageTracker) monthKey() string {
+	return t.now().Format("2006-01")
+}
+
+// Allow returns ErrBudget when this month's spend has reached the cap, and
+// ErrNoPrice when there is a cap but model has no price to count against it.
+func (t *UsageTracker) Allow(model string) error {
+	if t == nil || t.budget <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.prices[model]; !ok {
+		return fmt.Errorf("%w %q: add it to explain.prices to use monthly_budget_usd", ErrNoPrice, model)
+	}
+	if spent := t.months[t.monthKey()].CostUSD; spent >= t.budget {
+		return fmt.Errorf("%w: $%.2f of $%.2f spent this month", ErrBudget, spent, t.budget)
+	}
+	return nil
+}
+
+// Record adds one response's usage to the session and monthly totals.
+func (t *UsageTracker) Record(model string, u Usage) {
+	if t == nil {
+		return
+	}
+	p, priced := t.prices[model]
+	cost := (float64(u.PromptTokens)*p.PromptPer1M + float64(u.CompletionTokens)*p.CompletionPer1M) / 1e6
+
+	t.mu.Lock()
+	if !priced {
+		t.unpriced = model
+	}
+	add := func(tot UsageTotals) UsageTotals {
+		tot.Requests++
+		tot.PromptTokens += u.PromptTokens
+		tot.CompletionTokens += u.CompletionTokens
+		tot.CostUSD += cost
+		return tot
+	}
+	t.session = add(t.session)
+	key := t.monthKey()
+	t.months[key] = add(t.months[key])
+	t.saveErr = t.save()
+	t.mu.Unlock()
+
+	if t.OnChange != nil {
+		t.OnChange()
+	}
+}
+
+// save writes the monthly ledger. Caller holds t.mu.
+func (t *UsageTracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(t.months, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0o644)
+}
+
+// Status is the short text shown in the helper bar.
+func (t *UsageTracker) Status() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := "AI " + t.session.String()
+	if t.saveErr != nil {
+		s += " (ledger not saved)"
+	}
+	if t.unpriced != "" {
+		s += " [yellow](no price for " + tview.Escape(t.unpriced) + ", cost not counted)[-]"
+	}
+	if t.budget > 0 {
+		spent := t.months[t.monthKey()].CostUSD
+		if spent >= t.budget {
+			s += fmt.Sprintf(" | [red]budget $%.2f reached, explain off[-]", t.budget)
+		} else {
+			s += fmt.Sprintf(" | month $%.2f/$%.2f", spent, t.budget)
+		}
+	}
+	return s
+}
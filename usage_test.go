@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  float64
+		model   string
+		usage   Usage // recorded before asking again
+		wantErr error
+		status  string
+	}{
+		{"no budget, priced", 0, "gpt-4o-mini", Usage{PromptTokens: 10000}, nil, "AI 10000 tok $0.0015"},
+		{"no budget, unpriced", 0, "local-llama", Usage{PromptTokens: 1000}, nil, "no price for local-llama"},
+		{"under budget", 1, "gpt-4o", Usage{PromptTokens: 1000, CompletionTokens: 1000}, nil, "month $0.01/$1.00"},
+		{"budget spent", 0.01, "gpt-4o", Usage{PromptTokens: 1_000_000}, ErrBudget, "budget $0.01 reached"},
+		{"budget, unpriced", 1, "local-llama", Usage{}, ErrNoPrice, "month $0.00/$1.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUsageTracker(ExplainConfig{Prices: defaultPrices(), MonthlyBudgetUSD: tt.budget}, "")
+			u.now = func() time.Time { return time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC) }
+			u.Record(tt.model, tt.usage)
+			err := u.Allow(tt.model)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("Allow = %v, want %v", err, tt.wantErr)
+			}
+			if st := u.Status(); !strings.Contains(st, tt.status) {
+				t.Errorf("Status = %q, want it to contain %q", st, tt.status)
+			}
+		})
+	}
+}
+
+func TestNilUsageTracker(t *testing.T) {
+	var u *UsageTracker
+	if err := u.Allow("gpt-4o"); err != nil {
+		t.Errorf("Allow = %v", err)
+	}
+	u.Record("gpt-4o", Usage{PromptTokens: 10})
+	if u.Status() != "" {
+		t.Errorf("Status = %q", u.Status())
+	}
+}
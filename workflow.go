@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---------- two-phase scans ----------
+
+// DeepScan is one second-phase command of a two-phase scan.
+type DeepScan struct {
+	Host string
+	Cmd  string
+}
+
+// deepScanCommands composes the second phase of a two-phase scan: for every
+// host with open ports, nmap with the deep options on just those ports.
+func deepScanCommands(run *NmapRun, deep string) []DeepScan {
+	var scans []DeepScan
+	for _, h := range run.Hosts {
+		spec := portSpec(h.OpenPorts())
+		if spec == "" || h.Addr() == "" {
+			continue
+		}
+		scans = append(scans, DeepScan{
+			Host: h.Addr(),
+			Cmd:  strings.Join(strings.Fields("nmap "+deep+" -p "+spec+" "+h.Addr()), " "),
+		})
+	}
+	return scans
+}
+
+// portSpec renders ports for -p: "22,80" for TCP only, otherwise with
+// T: and U: (and S: for SCTP) prefixes.
+func portSpec(ports []Port) string {
+	byProto := make(map[string][]int)
+	for _, p := range ports {
+		byProto[p.Protocol] = append(byProto[p.Protocol], p.PortID)
+	}
+	list := func(nums []int) string {
+		sort.Ints(nums)
+		s := make([]string, len(nums))
+		for i, n := range nums {
+			s[i] = strconv.Itoa(n)
+		}
+		return strings.Join(s, ",")
+	}
+	if len(byProto) == 1 && len(byProto["tcp"]) > 0 {
+		return list(byProto["tcp"])
+	}
+	var parts []string
+	for _, proto := range []string{"tcp", "udp", "sctp"} {
+		if nums := byProto[proto]; len(nums) > 0 {
+			parts = append(parts, strings.ToUpper(proto[:1])+":"+list(nums))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// sweepResults parses the results written by the first phase of a finished job.
+func sweepResults(j *Job) (*NmapRun, error) {
+	if st, err := j.State(); st != JobDone {
+		if err == nil {
+			err = fmt.Errorf("job #%d %s", j.ID, st)
+		}
+		return nil, err
+	}
+	path := resultsPath(j.Cmd)
+	if path == "" {
+		return nil, fmt.Errorf("job #%d wrote no results file", j.ID)
+	}
+	run, _, err := parseNmapFile(path)
+	return run, err
+}
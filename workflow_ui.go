@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// twoPhaseForm asks for the sweep command and the deep-scan options of a
+// two-phase scan.
+func twoPhaseForm(sweep, deep string, done func(sweep, deep string, ok bool)) tview.Primitive {
+	form := tview.NewForm()
+	form.AddInputField("Phase 1 (sweep)", sweep, 0, nil, nil)
+	form.AddInputField("Phase 2 options", deep, 0, nil, nil)
+	form.AddTextView("", "Phase 2 runs once per host, with -p set to the open ports phase 1 found.", 0, 1, true, false)
+	form.AddButton("Start", func() {
+		done(form.GetFormItem(0).(*tview.InputField).GetText(), form.GetFormItem(1).(*tview.InputField).GetText(), true)
+	})
+	form.AddButton("Cancel", func() { done("", "", false) })
+	form.SetCancelFunc(func() { done("", "", false) })
+	form.SetBorder(true).SetTitle("Two-phase scan")
+	paintWidget(form, themePlain)
+	return modal(form, 90, 11)
+}
+
+// shardForm asks for the scan to shard and how: number of shards, how many
+// run at once and how often a failed shard is retried.
+func shardForm(cmd string, cfg ShardConfig, done func(cmd string, cfg ShardConfig, ok bool)) tview.Primitive {
+	form := tview.NewForm()
+	form.AddInputField("Scan", cmd, 0, nil, nil)
+	form.AddInputField("Shards", strconv.Itoa(cfg.Shards), 6, tview.InputFieldInteger, nil)
+	form.AddInputField("At once", strconv.Itoa(cfg.Concurrency), 6, tview.InputFieldInteger, nil)
+	form.AddInputField("Retries", strconv.Itoa(cfg.Retries), 6, tview.InputFieldInteger, nil)
+	form.AddTextView("", "The targets are split into shards, one nmap job each; their XML is merged into merged.xml.", 0, 1, true, false)
+	field := func(i int) string { return form.GetFormItem(i).(*tview.InputField).GetText() }
+	form.AddButton("Start", func() {
+		var c ShardConfig
+		c.Shards, _ = strconv.Atoi(field(1))
+		c.Concurrency, _ = strconv.Atoi(field(2))
+		c.Retries, _ = strconv.Atoi(field(3))
+		done(field(0), c, true)
+	})
+	form.AddButton("Cancel", func() { done("", cfg, false) })
+	form.SetCancelFunc(func() { done("", cfg, false) })
+	form.SetBorder(true).SetTitle("Sharded scan")
+	paintWidget(form, themePlain)
+	return modal(form, 100, 15)
+}
+
+// pipelineForm asks for the target of a pipeline run.
+func pipelineForm(p Pipeline, target string, done func(target string, ok bool)) tview.Primitive {
+	form := tview.NewForm()
+	form.AddTextView("Steps", tview.Escape(p.Describe()), 0, len(p.Steps), true, false)
+	form.AddInputField("Target", target, 0, nil, nil)
+	form.AddButton("Run", func() {
+		done(form.GetFormItem(1).(*tview.InputField).GetText(), true)
+	})
+	form.AddButton("Cancel", func() { done("", false) })
+	form.SetCancelFunc(func() { done("", false) })
+	form.SetBorder(true).SetTitle("Run pipeline " + p.Name)
+	paintWidget(form, themePlain)
+	return modal(form, 100, 9+len(p.Steps))
+}
+
+// pageRun is what the Pipelines page lists: a pipeline run or a sharded
+// scan, one line per step or shard after a title.
+type pageRun interface {
+	Status() []string
+	States() []StepState
+	Finished() bool
+}
+
+// pipelinesPage shows every pipeline run with the state of each step, and
+// every sharded scan with the state of each shard.
+type pipelinesPage struct {
+	*tview.Flex
+	view *tview.TextView
+	runs []pageRun
+}
+
+func newPipelinesPage() *pipelinesPage {
+	p := &pipelinesPage{view: tview.NewTextView()}
+	p.view.SetBorder(true).SetTitle("   ⛓ Pipelines & shards   ")
+	themed(p.view, themeAccent)
+	p.view.SetDynamicColors(true)
+	p.view.SetScrollable(true)
+
+	help := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	help.SetBorder(true).SetTitle("Pipelines")
+	themed(help, themePlain)
+	help.SetText("◀ " + keymap.Label("up") + "/" + keymap.Label("down") + " scroll | " + keymap.Help("jobs", "jobs") +
+		" | " + keymap.Label("pipelines") + "/" + keymap.Label("back") + " back ▶")
+
+	p.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(help, 3, 0, false).
+		AddItem(p.view, 0, 1, true)
+	themed(p.Flex, themePlain)
+	return p
+}
+
+// add shows a new run; call from the UI goroutine.
+func (p *pipelinesPage) add(r pageRun) {
+	p.runs = append(p.runs, r)
+	p.refresh()
+}
+
+var stepColors = map[StepState]string{
+	StepPending: "grey",
+	StepRunning: "yellow",
+	StepDone:    "green",
+	StepFailed:  "red",
+	StepSkipped: "orange",
+}
+
+func (p *pipelinesPage) refresh() {
+	if len(p.runs) == 0 {
+		p.view.SetText("No pipeline runs yet - select a pipeline (⛓) in the custom commands and press " + keymap.Label("queue") + ", or press " + keymap.Label("shard") + " to shard a scan")
+		return
+	}
+	var b strings.Builder
+	for _, r := range p.runs {
+		lines := r.Status()
+		b.WriteString("[::b]" + tview.Escape(lines[0]) + "[::-]\n")
+		for i, st := range r.States() {
+			fmt.Fprintf(&b, "[%s]%s[-]\n", stepColors[st], tview.Escape(lines[i+1]))
+		}
+		b.WriteString("\n")
+	}
+	p.view.SetText(b.String())
+}
+
+// tick refreshes the progress of running shards.
+func (p *pipelinesPage) tick(app *tview.Application) {
+	for range time.Tick(time.Second) {
+		app.QueueUpdate(func() {
+			for _, r := range p.runs {
+				if _, ok := r.(*ShardRun); ok && !r.Finished() {
+					go app.QueueUpdateDraw(p.refresh)
+					return
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WorkspaceMeta is workspace.json inside a workspace directory.
+type WorkspaceMeta struct {
+	Created time.Time `json:"created"`
+	Targets []string  `json:"targets"`
+	// Scope lists the IPs, CIDRs and hostnames (*.example.com allowed) that
+	// may be scanned; empty means no restriction.
+	Scope []string `json:"scope"`
+	// Redact, if set, replaces the global redaction rules for this engagement.
+	Redact *RedactConfig `json:"redact,omitempty"`
+	// ForbidCategories lists NSE categories (dos, exploit, ...) whose
+	// scripts may not be run in this engagement.
+	ForbidCategories []string `json:"forbid_categories,omitempty"`
+}
+
+// Workspace is a named engagement with its own targets, scope, custom
+// commands, history, output directory and results database, all stored
+// under <config dir>/workspaces/<name>.
+type Workspace struct {
+	Name string
+	Dir  string
+	Meta WorkspaceMeta
+}
+
+var workspaceNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func workspacesDir() string {
+	return filepath.Join(configDir(), "workspaces")
+}
+
+// openWorkspace loads a workspace, creating it if it does not exist.
+func openWorkspace(name string) (*Workspace, error) {
+	if !workspaceNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid workspace name %q", name)
+	}
+	ws := &Workspace{Name: name, Dir: filepath.Join(workspacesDir(), name)}
+	data, err := os.ReadFile(ws.metaPath())
+	switch {
+	case os.IsNotExist(err):
+		ws.Meta.Created = time.Now()
+		if err := os.MkdirAll(ws.OutputDir(), 0o755); err != nil {
+			return nil, err
+		}
+		return ws, ws.Save()
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ws.Meta); err != nil {
+		return nil, fmt.Errorf("%s: %w", ws.metaPath(), err)
+	}
+	return ws, nil
+}
+
+// listWorkspaces returns the names of all workspaces, sorted.
+func listWorkspaces() ([]string, error) {
+	entries, err := os.ReadDir(workspacesDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ws *Workspace) metaPath() string     { return filepath.Join(ws.Dir, "workspace.json") }
+func (ws *Workspace) CommandsPath() string { return filepath.Join(ws.Dir, "nmap-commands") }
+func (ws *Workspace) HistoryPath() string  { return filepath.Join(ws.Dir, "history") }
+func (ws *Workspace) OutputDir() string    { return filepath.Join(ws.Dir, "output") }
+func (ws *Workspace) DBPath() string       { return filepath.Join(ws.Dir, "results.db") }
+
+// Save writes workspace.json.
+func (ws *Workspace) Save() error {
+	data, err := json.MarshalIndent(ws.Meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ws.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(ws.metaPath(), data, 0o644)
+}
+
+// workspaceOutput is the output configuration with the workspace's own
+// output directory, if there is a workspace.
+func workspaceOutput(global OutputConfig, ws *Workspace) OutputConfig {
+	if ws != nil {
+		global.Dir = ws.OutputDir()
+	}
+	return global
+}
+
+// AddTarget remembers a target given on the command line.
+func (ws *Workspace) AddTarget(t string) error {
+	for _, have := range ws.Meta.Targets {
+		if have == t {
+			return nil
+		}
+	}
+	ws.Meta.Targets = append(ws.Meta.Targets, t)
+	return ws.Save()
+}
+
+// Target is what {target} expands to: all targets, space separated.
+func (ws *Workspace) Target() string {
+	return strings.Join(ws.Meta.Targets, " ")
+}
+
+// CustomCommands returns the global commands with the workspace's own
+// nmap-commands laid over them; a workspace entry replaces a global one
+// with the same name.
+func (ws *Workspace) CustomCommands(global []CustomCmd) []CustomCmd {
+	own, err := loadCustomCommands(ws.CommandsPath())
+	if err != nil || len(own) == 0 {
+		return global
+	}
+	byName := make(map[string]bool)
+	for _, c := range own {
+		byName[c.Name] = true
+	}
+	var cmds []CustomCmd
+	for _, c := range global {
+		if !byName[c.Name] && c.Cmd != "" {
+			cmds = append(cmds, c)
+		}
+	}
+	return append(cmds, own...)
+}
+
+// AppendHistory records a command that was queued or run.
+func (ws *Workspace) AppendHistory(name, cmd string) error {
+	f, err := os.OpenFile(ws.HistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), name, cmd)
+	return err
+}
+
+// InScope reports whether every target in args-style target text is inside
+// the workspace scope. It returns the first target that is not.
+func (ws *Workspace) InScope(targets []string) (string, bool) {
+	if len(ws.Meta.Scope) == 0 {
+		return "", true
+	}
+	for _, t := range targets {
+		if !ws.targetInScope(t) {
+			return t, false
+		}
+	}
+	return "", true
+}
+
+// Forbidden returns the NSE categories the workspace forbids; none without
+// a workspace.
+func (ws *Workspace) Forbidden() []string {
+	if ws == nil {
+		return nil
+	}
+	return ws.Meta.ForbidCategories
+}
+
+// CheckScripts refuses a command whose NSE scripts are in a category the
+// workspace forbids.
+func (ws *Workspace) CheckScripts(args []string, scripts []NSEScript) error {
+	if bad := forbiddenOf(commandScriptCategories(args, scripts), ws.Forbidden()); len(bad) > 0 {
+		return fmt.Errorf("workspace %s forbids NSE %s scripts", ws.Name, strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+func (ws *Workspace) targetInScope(t string) bool {
+	for _, s := range ws.Meta.Scope {
+		switch {
+		case s == t:
+			return true
+		case strings.HasPrefix(s, "*."):
+			if strings.HasSuffix(t, s[1:]) {
+				return true
+			}
+		case strings.Contains(s, "/"):
+			_, scope, err := net.ParseCIDR(s)
+			if err != nil {
+				continue
+			}
+			if ip := net.ParseIP(t); ip != nil && scope.Contains(ip) {
+				return true
+			}
+			if _, sub, err := net.ParseCIDR(t); err == nil {
+				ones, _ := sub.Mask.Size()
+				sOnes, _ := scope.Mask.Size()
+				if scope.Contains(sub.IP) && ones >= sOnes {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ---------- import / export ----------
+
+// exportWorkspace writes the workspace directory as a .tar.gz.
+func exportWorkspace(ws *Workspace, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(ws.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ws.Dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(ws.Name, rel))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// importWorkspace unpacks a tarball made by exportWorkspace. The workspace
+// is named after the archive's top directory unless name is given; an
+// existing workspace is never overwritten.
+func importWorkspace(r io.Reader, name string) (*Workspace, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var dest string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.SplitN(filepath.ToSlash(filepath.Clean(hdr.Name)), "/", 2)
+		if dest == "" {
+			if name == "" {
+				name = parts[0]
+			}
+			if !workspaceNameRe.MatchString(name) {
+				return nil, fmt.Errorf("invalid workspace name %q", name)
+			}
+			dest = filepath.Join(workspacesDir(), name)
+			if _, err := os.Stat(dest); err == nil {
+				return nil, fmt.Errorf("workspace %q already exists", name)
+			}
+		}
+		if len(parts) < 2 {
+			continue // the top directory itself
+		}
+		rel := filepath.FromSlash(parts[1])
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+			return nil, fmt.Errorf("unsafe path in archive: %s", hdr.Name)
+		}
+		path := filepath.Join(dest, rel)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return nil, err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if dest == "" {
+		return nil, fmt.Errorf("empty archive")
+	}
+	return openWorkspace(name)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// workspacePage lists the workspaces and switches to the selected one.
+type workspacePage struct {
+	*tview.Flex
+	list   *tview.List
+	info   *tview.TextView
+	names  []string
+	onOpen func(name string)
+}
+
+func newWorkspacePage(onOpen func(name string)) *workspacePage {
+	p := &workspacePage{
+		list:   tview.NewList().ShowSecondaryText(false),
+		info:   tview.NewTextView(),
+		onOpen: onOpen,
+	}
+	p.list.SetBorder(true).SetTitle("   🗂 Workspaces   ")
+	themed(p.list, themeAccent)
+	p.list.SetChangedFunc(func(int, string, string, rune) { p.showInfo() })
+
+	p.info.SetBorder(true).SetTitle("Workspace")
+	themed(p.info, themePlain)
+	p.info.SetDynamicColors(true)
+
+	help := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	help.SetBorder(true).SetTitle("Workspaces")
+	themed(help, themePlain)
+	help.SetText("◀ " + keymap.Label("up") + "/" + keymap.Label("down") + " select | Enter switch | " +
+		keymap.Label("workspaces") + "/" + keymap.Label("back") + " back ▶")
+
+	p.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(help, 3, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(p.list, 0, 1, true).
+			AddItem(p.info, 0, 2, false), 0, 1, true)
+	themed(p.Flex, themePlain)
+	return p
+}
+
+// refresh reloads the workspace names; current is marked.
+func (p *workspacePage) refresh(current string) {
+	names, err := listWorkspaces()
+	p.list.Clear()
+	p.names = names
+	for _, n := range names {
+		n := n
+		label := n
+		if n == current {
+			label = "● " + n
+		}
+		p.list.AddItem(label, "", 0, func() { p.onOpen(n) })
+	}
+	p.list.AddItem("+ New workspace…", "", 0, nil)
+	if err != nil {
+		p.info.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	p.showInfo()
+}
+
+// isNewItem reports whether the "New workspace" entry is selected.
+func (p *workspacePage) isNewItem() bool {
+	return p.list.GetCurrentItem() == len(p.names)
+}
+
+func (p *workspacePage) showInfo() {
+	i := p.list.GetCurrentItem()
+	if i < 0 || i >= len(p.names) {
+		p.info.SetText("Create a workspace for a new engagement: its own targets, scope,\ncustom commands, history, output directory and results database.")
+		return
+	}
+	ws, err := openWorkspace(p.names[i])
+	if err != nil {
+		p.info.SetText("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	text := fmt.Sprintf("[green]%s[-]\ncreated %s\n\n[yellow]Targets[-]\n", ws.Name, ws.Meta.Created.Format("2006-01-02"))
+	for _, t := range ws.Meta.Targets {
+		text += "  " + tview.Escape(t) + "\n"
+	}
+	text += "\n[yellow]Scope[-]\n"
+	if len(ws.Meta.Scope) == 0 {
+		text += "  (unrestricted)\n"
+	}
+	for _, s := range ws.Meta.Scope {
+		text += "  " + tview.Escape(s) + "\n"
+	}
+	text += "\n[yellow]Directory[-]\n  " + tview.Escape(ws.Dir)
+	p.info.SetText(text)
+}
+
+// newWorkspaceForm asks for the name and targets of a workspace to create.
+func newWorkspaceForm(done func(name, targets string, ok bool)) tview.Primitive {
+	form := tview.NewForm()
+	form.AddInputField("Name", "", 30, nil, nil)
+	form.AddInputField("Targets", "", 40, nil, nil)
+	text := func(i int) string {
+		return form.GetFormItem(i).(*tview.InputField).GetText()
+	}
+	form.AddButton("Create", func() { done(text(0), text(1), true) })
+	form.AddButton("Cancel", func() { done("", "", false) })
+	form.SetCancelFunc(func() { done("", "", false) })
+	form.SetBorder(true).SetTitle("New workspace")
+	paintWidget(form, themePlain)
+	return modal(form, 60, 9)
+}